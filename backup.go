@@ -0,0 +1,166 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrBackupDirNotEmpty = errors.New("backup directory is not empty")
+
+// backupFile 需要复制到备份目录的文件，size为-1表示复制整个文件
+type backupFile struct {
+	src  *os.File
+	dst  string
+	size int64
+}
+
+// Backup 在线备份到dir，dir不存在或为空时才能备份，备份可以直接用NewBitcask打开。
+// 只在同步活跃文件并为其余文件创建硬链接时持有写锁，无法硬链接的文件
+// （如跨文件系统）先打开再在锁外复制，活跃文件只复制到同步时的位置
+func (b *Bitcask) Backup(dir string) error {
+	if err := prepareEmptyDir(dir); err != nil {
+		return err
+	}
+	copies, err := b.linkBackupFiles(dir)
+	defer func() {
+		for _, f := range copies {
+			f.src.Close()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	for _, f := range copies {
+		if err := copyFileRange(f.src, f.dst, f.size); err != nil {
+			return fmt.Errorf("failed to copy %s: %v", f.dst, err)
+		}
+	}
+	for _, d := range []string{getWalDir(dir), getBlobDir(dir)} {
+		if err := syncDir(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareEmptyDir 创建备份或恢复的目标目录，目录已存在时必须为空
+func prepareEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read directory %s: %v", dir, err)
+	}
+	if len(entries) > 0 {
+		return ErrBackupDirNotEmpty
+	}
+	for _, d := range []string{getWalDir(dir), getBlobDir(dir)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", d, err)
+		}
+	}
+	return nil
+}
+
+// linkBackupFiles 持有写锁同步活跃文件，为已封存的文件创建硬链接，
+// 返回需要在锁外复制的文件。文件已打开，之后被合并替换或删除也不影响复制
+func (b *Bitcask) linkBackupFiles(dir string) ([]backupFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// 先同步blob再同步wal，保证备份中的指针不会指向不存在的blob
+	if err := b.syncBlob(); err != nil {
+		return nil, err
+	}
+	if err := b.activeWal.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync active wal: %v", err)
+	}
+
+	copies := make([]backupFile, 0)
+	srcDirs := []string{getWalDir(b.config.DirPath), getBlobDir(b.config.DirPath)}
+	dstDirs := []string{getWalDir(dir), getBlobDir(dir)}
+	active := map[string]int64{
+		filepath.Join(srcDirs[0], getWalFileName(b.fileId)): b.activeWal.GetOffset(),
+	}
+	if b.activeBlob != nil {
+		active[filepath.Join(srcDirs[1], getBlobFileName(b.blobId))] = b.activeBlob.GetOffset()
+	}
+
+	for i, srcDir := range srcDirs {
+		files, err := os.ReadDir(srcDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return copies, fmt.Errorf("failed to read directory %s: %v", srcDir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !isDataFile(file.Name()) {
+				continue
+			}
+			src := filepath.Join(srcDir, file.Name())
+			dst := filepath.Join(dstDirs[i], file.Name())
+			size, isActive := active[src]
+			if !isActive {
+				if err := os.Link(src, dst); err == nil {
+					continue
+				}
+				size = -1
+			}
+			f, err := os.Open(src)
+			if err != nil {
+				return copies, fmt.Errorf("failed to open %s: %v", src, err)
+			}
+			copies = append(copies, backupFile{src: f, dst: dst, size: size})
+		}
+	}
+	return copies, nil
+}
+
+// isDataFile 判断是否为需要备份的wal、hint或blob文件
+func isDataFile(name string) bool {
+	for _, ext := range []string{".wal", ".hint", ".blob"} {
+		if _, ok, err := parseFileId(name, ext); ok && err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFileRange 复制src的前size字节到dst并同步，size为-1时复制整个文件
+func copyFileRange(src *os.File, dst string, size int64) error {
+	if size < 0 {
+		info, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(src, 0, size)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir 同步目录，保证新建的文件在目录中可见
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %v", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %v", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-backup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:       filepath.Join(dir, "db"),
+		MaxFileSize:   1024,
+		IndexType:     "btree",
+		BlobThreshold: 100,
+		BlobFileSize:  1024,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	ma := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		key := utils.GenerateKey(i)
+		value := []byte(fmt.Sprintf("value-%d", i))
+		if i%10 == 0 {
+			value = bytes.Repeat(value, 20)
+		}
+		db.Put(key, value)
+		ma[string(key)] = value
+	}
+	db.Del(utils.GenerateKey(1))
+	delete(ma, string(utils.GenerateKey(1)))
+
+	openBackup := func(t *testing.T, backupDir string) *Bitcask {
+		backup, err := NewBitcask(&Config{
+			DirPath:     backupDir,
+			MaxFileSize: 1024,
+			IndexType:   "btree",
+		})
+		if err != nil {
+			t.Fatalf("failed to open backup: %v", err)
+		}
+		return backup
+	}
+	check := func(t *testing.T, db *Bitcask) {
+		for key, want := range ma {
+			if value, ok := db.Get([]byte(key)); !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+		if _, ok := db.Get(utils.GenerateKey(1)); ok {
+			t.Fatal("deleted key should not exist in backup")
+		}
+	}
+
+	t.Run("Concurrent Writes", func(t *testing.T) {
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				db.Put([]byte(fmt.Sprintf("concurrent-%d", i)), bytes.Repeat([]byte("x"), 50+i%100))
+			}
+		}()
+
+		backupDir := filepath.Join(dir, "backup1")
+		err := db.Backup(backupDir)
+		close(stop)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("Backup failed: %v", err)
+		}
+
+		backup := openBackup(t, backupDir)
+		defer backup.Close()
+		check(t, backup)
+		if len(backup.Recovery()) != 0 {
+			t.Fatalf("backup should not need recovery: %+v", backup.Recovery())
+		}
+	})
+
+	t.Run("Independent Of Source", func(t *testing.T) {
+		backupDir := filepath.Join(dir, "backup2")
+		if err := db.Backup(backupDir); err != nil {
+			t.Fatalf("Backup failed: %v", err)
+		}
+		// 备份后源数据库继续写入和合并，不影响备份
+		for key := range ma {
+			db.Del([]byte(key))
+		}
+		if err := db.Merge(); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if _, err := db.BlobGC(); err != nil {
+			t.Fatalf("BlobGC failed: %v", err)
+		}
+
+		backup := openBackup(t, backupDir)
+		defer backup.Close()
+		check(t, backup)
+		backup.Put([]byte("backup-only"), []byte("value"))
+		if _, ok := db.Get([]byte("backup-only")); ok {
+			t.Fatal("writes to backup should not affect source")
+		}
+	})
+
+	t.Run("Not Empty", func(t *testing.T) {
+		backupDir := filepath.Join(dir, "backup1")
+		if err := db.Backup(backupDir); !errors.Is(err, ErrBackupDirNotEmpty) {
+			t.Fatalf("expected ErrBackupDirNotEmpty, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var ErrBatchCommitted = errors.New("batch is already committed")
+
+// WriteBatch 原子批量写入，提交前所有修改只保存在内存中
+type WriteBatch struct {
+	db        *Bitcask
+	mu        sync.Mutex
+	records   []*record.Header // 待写入的记录
+	committed bool             // 是否已提交
+}
+
+// NewBatch 创建一个批量写入
+func (b *Bitcask) NewBatch() *WriteBatch {
+	return &WriteBatch{
+		db:      b,
+		records: make([]*record.Header, 0),
+	}
+}
+
+// Put 在批量写入中添加一个键值对
+func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	if err := wb.db.checkKey(key); err != nil {
+		return err
+	}
+	if err := wb.db.checkValue(value); err != nil {
+		return err
+	}
+	return wb.add(key, value, record.RecordTypeNormal, 0)
+}
+
+// putExpireAt 在批量写入中添加一个在expireAt过期的键值对
+func (wb *WriteBatch) putExpireAt(key []byte, value []byte, expireAt int64) error {
+	if err := wb.db.checkKey(key); err != nil {
+		return err
+	}
+	if err := wb.db.checkValue(value); err != nil {
+		return err
+	}
+	return wb.add(key, value, record.RecordTypeNormal, expireAt)
+}
+
+// Delete 在批量写入中删除一个key
+func (wb *WriteBatch) Delete(key []byte) error {
+	if err := wb.db.checkKey(key); err != nil {
+		return err
+	}
+	return wb.add(key, nil, record.RecordTypeDeleted, 0)
+}
+
+func (wb *WriteBatch) add(key []byte, value []byte, typ record.RecordType, expireAt int64) error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if wb.committed {
+		return ErrBatchCommitted
+	}
+	wb.records = append(wb.records, &record.Header{
+		Key:        append([]byte(nil), key...),
+		Value:      append([]byte(nil), value...),
+		RecordType: typ,
+		ExpireAt:   expireAt,
+	})
+	return nil
+}
+
+// Commit 将批量写入以事务的形式写入wal并更新索引，
+// 崩溃恢复时没有提交记录的批量写入不会生效
+func (wb *WriteBatch) Commit() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	if wb.committed {
+		return ErrBatchCommitted
+	}
+	wb.committed = true
+	if len(wb.records) == 0 {
+		return nil
+	}
+
+	db := wb.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.writeBatch(wb.records); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeBatch 以事务的形式写入一组记录并更新索引，每条记录计入put或del，调用方需持有写锁
+func (b *Bitcask) writeBatch(records []*record.Header) (err error) {
+	defer func() {
+		b.metrics.observeBatch(records, err != nil)
+	}()
+	batchId := make([]byte, 8)
+	binary.BigEndian.PutUint64(batchId, b.batchSeq.Add(1))
+	// 大value先写入blob文件
+	separated := make([]*record.Header, 0, len(records))
+	for _, r := range records {
+		r.Seq = b.seq.Add(1)
+		r, err := b.separateValue(r)
+		if err != nil {
+			return err
+		}
+		separated = append(separated, r)
+	}
+	records = separated
+	positions, err := b.activeWal.AppendBatch(batchId, records)
+	if err != nil {
+		return fmt.Errorf("failed to append batch to wal: %v", err)
+	}
+	for i, r := range records {
+		if r.RecordType == record.RecordTypeNormal {
+			if err := b.indexPut(r.Key, positions[i]); err != nil {
+				return fmt.Errorf("failed to put key to index: %v", err)
+			}
+		} else if err := b.indexDelete(r.Key); err != nil && err != index.ErrKeyNotFound {
+			return fmt.Errorf("failed to delete key from index: %v", err)
+		}
+	}
+	if err := b.tryCreateNewWalFile(); err != nil {
+		return fmt.Errorf("failed to create new wal file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/utils"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+func TestWriteBatch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-batch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+
+	if err := db.Put(utils.GenerateKey(0), []byte("old")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	batch := db.NewBatch()
+	ma := make(map[string][]byte)
+	for i := 1; i < 20; i++ {
+		key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+		if err := batch.Put(key, value); err != nil {
+			t.Fatalf("failed to put to batch: %v", err)
+		}
+		ma[string(key)] = value
+	}
+	if err := batch.Delete(utils.GenerateKey(0)); err != nil {
+		t.Fatalf("failed to delete in batch: %v", err)
+	}
+
+	// 提交前不可见
+	if _, ok := db.Get(utils.GenerateKey(1)); ok {
+		t.Fatal("batch should not be visible before commit")
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("failed to commit batch: %v", err)
+	}
+	if err := batch.Commit(); !errors.Is(err, ErrBatchCommitted) {
+		t.Fatalf("expected ErrBatchCommitted, got %v", err)
+	}
+	if err := batch.Put(utils.GenerateKey(100), []byte("value")); !errors.Is(err, ErrBatchCommitted) {
+		t.Fatalf("expected ErrBatchCommitted, got %v", err)
+	}
+
+	check := func(db *Bitcask) {
+		if _, ok := db.Get(utils.GenerateKey(0)); ok {
+			t.Fatal("deleted key should not be visible")
+		}
+		for key, want := range ma {
+			value, ok := db.Get([]byte(key))
+			if !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+	check(db)
+	db.Close()
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	check(db)
+	db.Close()
+
+	// 模拟提交记录写入前崩溃
+	wals, err := filepath.Glob(filepath.Join(getWalDir(dir), "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := wals[len(wals)-1]
+	fileId, _, _ := parseWalFileId(filepath.Base(newest))
+	w, err := wal.NewWAL(newest, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write((&record.Header{Key: []byte("batch"), RecordType: record.RecordTypeTransactionBegin}).Encode(w.Version()))
+	w.Write((&record.Header{Key: []byte("uncommitted"), Value: []byte("value"), RecordType: record.RecordTypeNormal}).Encode(w.Version()))
+	w.Close()
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	defer db.Close()
+	if _, ok := db.Get([]byte("uncommitted")); ok {
+		t.Fatal("uncommitted batch should not be visible")
+	}
+	if len(db.Recovery()) != 1 {
+		t.Fatalf("unexpected recovery report: %+v", db.Recovery())
+	}
+	check(db)
+}
@@ -2,14 +2,43 @@ package bitcask
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
 	"github.com/xia-Sang/bitcask/utils"
+	"github.com/xia-Sang/bitcask/wal"
 )
 
 func TestBitcask(t *testing.T) {
+	// 在临时目录中打开test目录下旧格式数据的副本，避免测试写入修改原数据
+	dir := t.TempDir()
+	walDir := getWalDir(dir)
+	if err := os.MkdirAll(walDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(getWalDir("./test"), "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(walDir, filepath.Base(file)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	conf := &Config{
-		DirPath:     "./test",
+		DirPath:     dir,
 		MaxFileSize: 512,
 		IndexType:   "btree",
 	}
@@ -41,3 +70,580 @@ func TestBitcask(t *testing.T) {
 	}
 	db.Close()
 }
+
+func TestBitcaskHint(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-hint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	ma := make(map[string][]byte)
+	for i := 0; i < 60; i++ {
+		key, value := utils.GenerateKey(i%40), utils.GenerateValue(10)
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		ma[string(key)] = value
+	}
+	for i := 0; i < 5; i++ {
+		key := utils.GenerateKey(i)
+		if err := db.Del(key); err != nil {
+			t.Fatalf("failed to del: %v", err)
+		}
+		delete(ma, string(key))
+	}
+	db.Close()
+
+	// 每个已封存的文件都应该有hint文件
+	walDir := getWalDir(dir)
+	hints, err := filepath.Glob(filepath.Join(walDir, "*.hint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wals, err := filepath.Glob(filepath.Join(walDir, "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hints) != len(wals)-1 {
+		t.Fatalf("hint file count mismatch: got %d, want %d", len(hints), len(wals)-1)
+	}
+
+	check := func() {
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		defer db.Close()
+		for i := 0; i < 40; i++ {
+			key := utils.GenerateKey(i)
+			value, ok := db.Get(key)
+			want, exist := ma[string(key)]
+			if ok != exist {
+				t.Fatalf("key %s existence mismatch: got %v, want %v", key, ok, exist)
+			}
+			if exist && !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+	check()
+
+	// 损坏的hint文件回退到全量扫描
+	data, err := os.ReadFile(hints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(hints[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(hints[1])
+	check()
+
+	// 回退后hint文件会被重新生成
+	if _, err := wal.ReadHint(hints[1], fileSize(t, strings.TrimSuffix(hints[1], ".hint")+".wal")); err != nil {
+		t.Fatalf("hint file should be regenerated: %v", err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestBitcaskLock(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+
+	// 目录被占用时再次打开应该失败
+	if _, err := NewBitcask(conf); !errors.Is(err, ErrDatabaseLocked) {
+		t.Fatalf("expected ErrDatabaseLocked, got %v", err)
+	}
+
+	// 关闭后可以重新打开
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close bitcask: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	db.Close()
+}
+
+func TestBitcaskSyncPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{"Always", SyncAlways},
+		{"Interval", SyncInterval},
+		{"Bytes", SyncBytes},
+		{"Never", SyncNever},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask-sync-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			conf := &Config{
+				DirPath:      dir,
+				MaxFileSize:  512,
+				IndexType:    "btree",
+				SyncPolicy:   tc.policy,
+				SyncInterval: 10 * time.Millisecond,
+				BytesPerSync: 128,
+			}
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("failed to create bitcask: %v", err)
+			}
+			ma := make(map[string][]byte)
+			for i := 0; i < 50; i++ {
+				key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+				if err := db.Put(key, value); err != nil {
+					t.Fatalf("failed to put: %v", err)
+				}
+				ma[string(key)] = value
+			}
+			if err := db.Sync(); err != nil {
+				t.Fatalf("failed to sync: %v", err)
+			}
+			db.Close()
+
+			db, err = NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("failed to reopen bitcask: %v", err)
+			}
+			defer db.Close()
+			for key, want := range ma {
+				value, ok := db.Get([]byte(key))
+				if !ok || !bytes.Equal(value, want) {
+					t.Fatalf("value mismatch for key %s", key)
+				}
+			}
+		})
+	}
+
+	t.Run("Invalid Interval", func(t *testing.T) {
+		conf := &Config{
+			DirPath:    "./invalid",
+			IndexType:  "btree",
+			SyncPolicy: SyncInterval,
+		}
+		if _, err := NewBitcask(conf); err == nil {
+			t.Fatal("expected error for invalid sync interval")
+		}
+	})
+}
+
+func TestBitcaskLimits(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-limits-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:        dir,
+		MaxFileSize:    512,
+		MaxKeyLength:   16,
+		MaxValueLength: 32,
+		IndexType:      "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	testCases := []struct {
+		name  string
+		key   []byte
+		value []byte
+		want  error
+	}{
+		{"Empty Key", nil, []byte("value"), ErrEmptyKey},
+		{"Key Too Large", bytes.Repeat([]byte("k"), 17), []byte("value"), ErrKeyTooLarge},
+		{"Value Too Large", []byte("key"), bytes.Repeat([]byte("v"), 33), ErrValueTooLarge},
+		{"Max Size", bytes.Repeat([]byte("k"), 16), bytes.Repeat([]byte("v"), 32), nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := db.Put(tc.key, tc.value); !errors.Is(err, tc.want) {
+				t.Errorf("Put returned %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if err := db.Del(nil); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Del returned %v, want %v", err, ErrEmptyKey)
+	}
+	if err := db.Del(bytes.Repeat([]byte("k"), 17)); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("Del returned %v, want %v", err, ErrKeyTooLarge)
+	}
+
+	t.Run("Lower Limits After Reopen", func(t *testing.T) {
+		// 写满几个文件，再删除hint文件，让已封存的文件也需要全量扫描
+		for i := 0; i < 40; i++ {
+			if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte("v"), 32)); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		db.Close()
+		hints, _ := filepath.Glob(filepath.Join(getWalDir(dir), "*.hint"))
+		for _, hint := range hints {
+			os.Remove(hint)
+		}
+
+		// 调小的限制只影响之后的写入，已写入的记录仍然可以读取
+		lower := *conf
+		lower.MaxKeyLength = 4
+		lower.MaxValueLength = 8
+		db, err = NewBitcask(&lower)
+		if err != nil {
+			t.Fatalf("failed to reopen with lower limits: %v", err)
+		}
+		if len(db.Recovery()) != 0 {
+			t.Fatalf("nothing should be truncated: %+v", db.Recovery())
+		}
+		for i := 0; i < 40; i++ {
+			if value, ok := db.Get([]byte(fmt.Sprintf("key-%d", i))); !ok || len(value) != 32 {
+				t.Fatalf("key-%d lost after reopen", i)
+			}
+		}
+		if err := db.Put([]byte("key"), bytes.Repeat([]byte("v"), 9)); !errors.Is(err, ErrValueTooLarge) {
+			t.Fatalf("Put returned %v, want %v", err, ErrValueTooLarge)
+		}
+	})
+}
+
+func TestBitcaskRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-recovery-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	ma := make(map[string][]byte)
+	for i := 0; i < 30; i++ {
+		key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		ma[string(key)] = value
+	}
+	db.Close()
+
+	wals, err := filepath.Glob(filepath.Join(getWalDir(dir), "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := wals[len(wals)-1]
+
+	// 模拟写了一半的记录
+	torn := []byte{0, 0, 0, 0, 9, 0}
+	fp, err := os.OpenFile(newest, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp.Write(torn)
+	fp.Close()
+
+	t.Run("Strict", func(t *testing.T) {
+		strict := *conf
+		strict.RecoveryPolicy = RecoveryStrict
+		if _, err := NewBitcask(&strict); err == nil {
+			t.Fatal("expected error with strict recovery policy")
+		}
+	})
+
+	t.Run("Truncate Tail", func(t *testing.T) {
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		reports := db.Recovery()
+		if len(reports) != 1 || reports[0].DroppedBytes != int64(len(torn)) {
+			t.Fatalf("unexpected recovery report: %+v", reports)
+		}
+
+		// 截断后继续写入
+		key, value := utils.GenerateKey(100), utils.GenerateValue(10)
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		ma[string(key)] = value
+		db.Close()
+
+		db, err = NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		defer db.Close()
+		if len(db.Recovery()) != 0 {
+			t.Fatalf("unexpected recovery report: %+v", db.Recovery())
+		}
+		for key, want := range ma {
+			value, ok := db.Get([]byte(key))
+			if !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	})
+
+	t.Run("Corrupted Sealed File", func(t *testing.T) {
+		sealed := wals[0]
+		os.Remove(strings.TrimSuffix(sealed, ".wal") + ".hint")
+		data, err := os.ReadFile(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		if err := os.WriteFile(sealed, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewBitcask(conf); err == nil {
+			t.Fatal("expected error for corrupted sealed file")
+		}
+
+		truncateAll := *conf
+		truncateAll.RecoveryPolicy = RecoveryTruncateAll
+		db, err := NewBitcask(&truncateAll)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		defer db.Close()
+		if len(db.Recovery()) != 1 {
+			t.Fatalf("unexpected recovery report: %+v", db.Recovery())
+		}
+	})
+}
+
+func TestBitcaskFormat(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-format-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 构造没有文件头的旧格式文件
+	walDir := getWalDir(dir)
+	if err := os.MkdirAll(walDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for i := 0; i < 10; i++ {
+		data = append(data, (&record.Header{Key: utils.GenerateKey(i), Value: []byte("legacy")}).ToBytes()...)
+	}
+	if err := os.WriteFile(filepath.Join(walDir, getWalFileName(0)), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 1024,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to open legacy bitcask: %v", err)
+	}
+
+	// 旧格式的文件被封存，新写入使用新格式
+	if db.activeWal.GetFileID() != 1 || db.activeWal.Version() != record.FormatCurrent {
+		t.Fatalf("unexpected active wal: id=%d version=%d", db.activeWal.GetFileID(), db.activeWal.Version())
+	}
+	if err := db.Put([]byte("new"), []byte("value")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := db.Put([]byte("new2"), []byte("value")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	lastSeq := db.seq.Load()
+	db.Close()
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		if value, ok := db.Get(utils.GenerateKey(i)); !ok || !bytes.Equal(value, []byte("legacy")) {
+			t.Fatalf("legacy value mismatch for key %s", utils.GenerateKey(i))
+		}
+	}
+
+	// 序列号和时间戳持久化，重新打开后序列号继续递增
+	pos, err := db.curIndex.Get([]byte("new2"))
+	if err != nil {
+		t.Fatalf("failed to get position: %v", err)
+	}
+	header, ok := db.readRecord(pos)
+	if !ok || header.Seq != lastSeq || header.Timestamp == 0 {
+		t.Fatalf("unexpected record: %+v", header)
+	}
+	if db.seq.Load() != lastSeq {
+		t.Fatalf("seq mismatch after reopen: got %d, want %d", db.seq.Load(), lastSeq)
+	}
+	if err := db.Put([]byte("new3"), []byte("value")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if db.seq.Load() != lastSeq+1 {
+		t.Fatalf("seq should increase, got %d", db.seq.Load())
+	}
+}
+
+func TestBitcaskIndexType(t *testing.T) {
+	for _, typ := range []string{"btree", "art", "skiplist", "hash", "disk"} {
+		t.Run(typ, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "bitcask-index-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			conf := &Config{
+				DirPath:     dir,
+				MaxFileSize: 512,
+				IndexType:   typ,
+			}
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("failed to create bitcask: %v", err)
+			}
+			for i := 0; i < 50; i++ {
+				db.Put(utils.GenerateKey(i), []byte("value"))
+			}
+			db.Del(utils.GenerateKey(0))
+			db.Close()
+
+			db, err = NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("failed to reopen bitcask: %v", err)
+			}
+			defer db.Close()
+			if _, ok := db.Get(utils.GenerateKey(0)); ok {
+				t.Fatal("deleted key should not exist")
+			}
+			for i := 1; i < 50; i++ {
+				if value, ok := db.Get(utils.GenerateKey(i)); !ok || !bytes.Equal(value, []byte("value")) {
+					t.Fatalf("value mismatch for key %s", utils.GenerateKey(i))
+				}
+			}
+		})
+	}
+
+	t.Run("Disk Key Too Large", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "bitcask-index-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		conf := &Config{DirPath: dir, MaxFileSize: 1 << 20, IndexType: "disk"}
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to create bitcask: %v", err)
+		}
+		large := bytes.Repeat([]byte("k"), index.DiskMaxKeySize+1)
+		if err := db.Put(large, []byte("value")); !errors.Is(err, ErrKeyTooLarge) {
+			t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+		}
+		batch := db.NewBatch()
+		if err := batch.Put(large, []byte("value")); !errors.Is(err, ErrKeyTooLarge) {
+			t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+		}
+		if err := db.Put(large[:index.DiskMaxKeySize], []byte("value")); err != nil {
+			t.Fatalf("failed to put max size key: %v", err)
+		}
+		db.Close()
+
+		// 被拒绝的key没有写入wal，可以正常重新打开
+		db, err = NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		defer db.Close()
+		if _, ok := db.Get(large[:index.DiskMaxKeySize]); !ok {
+			t.Fatal("max size key should exist after reopen")
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "bitcask-index-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if _, err := NewBitcask(&Config{DirPath: dir, IndexType: "unknown"}); !errors.Is(err, index.ErrUnknownIndexType) {
+			t.Fatalf("expected ErrUnknownIndexType, got %v", err)
+		}
+	})
+}
+
+func TestBitcaskClose(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-close-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewBitcask(&Config{
+		DirPath:      dir,
+		MaxFileSize:  1024,
+		IndexType:    "btree",
+		SyncPolicy:   SyncInterval,
+		SyncInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := db.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
@@ -1,19 +1,34 @@
 package bitcask
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gofrs/flock"
 	"github.com/xia-Sang/bitcask/index"
 	"github.com/xia-Sang/bitcask/record"
 	"github.com/xia-Sang/bitcask/wal"
 )
 
+const lockFileName = "LOCK" // 目录锁文件
+
+var (
+	ErrDatabaseLocked = errors.New("database is locked by another process")
+	ErrClosed         = errors.New("database is closed")
+	ErrEmptyKey       = errors.New("key is empty")
+	ErrKeyTooLarge    = errors.New("key is too large")
+	ErrValueTooLarge  = errors.New("value is too large")
+)
+
 type Bitcask struct {
 	config    *Config            // 配置
 	olderWal  map[int64]*wal.WAL // 旧的wal
@@ -22,48 +37,199 @@ type Bitcask struct {
 	mu        sync.RWMutex       // 读写锁
 	fileId    int64              // 当前文件id
 	fileIds   []int64            // 所有文件id
+	merging   atomic.Bool        // 是否正在合并
+	closed    atomic.Bool        // 是否已关闭
+	fileLock  *flock.Flock       // 目录锁
+	closeCh   chan struct{}      // 关闭后台任务
+	wg        sync.WaitGroup     // 等待后台任务退出
+	recovery  []RecoveryReport   // 启动时的恢复结果
+	batchSeq  atomic.Uint64      // 批量写入序号
+	seq       atomic.Uint64      // 已分配的最大记录序列号
+
+	blobs      map[int64]*wal.WAL // 所有blob文件
+	activeBlob *wal.WAL           // 当前写入的blob文件
+	blobId     int64              // 当前blob文件id
+
+	pins    map[*wal.WAL]int  // 文件被快照引用的次数
+	retired map[*wal.WAL]bool // 已被合并或回收但仍被快照引用的文件，引用释放后关闭
+
+	liveBytes map[int64]int64 // 每个wal文件中仍被索引引用的记录大小
+	metrics   metrics         // 运行统计
 }
 
 func NewBitcask(config *Config) (*Bitcask, error) {
+	switch config.syncPolicy() {
+	case SyncInterval:
+		if config.SyncInterval <= 0 {
+			return nil, fmt.Errorf("invalid sync interval: %v", config.SyncInterval)
+		}
+	case SyncBytes:
+		if config.BytesPerSync <= 0 {
+			return nil, fmt.Errorf("invalid bytes per sync: %d", config.BytesPerSync)
+		}
+	}
+
 	// 确保主目录存在
 	if err := os.MkdirAll(config.DirPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %v", err)
 	}
 
+	// 获取目录锁，防止多个进程同时打开同一目录
+	fileLock := flock.New(filepath.Join(config.DirPath, lockFileName))
+	locked, err := fileLock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock data directory: %v", err)
+	}
+	if !locked {
+		return nil, ErrDatabaseLocked
+	}
+
 	// 确保 WAL 目录存在
 	walDir := getWalDir(config.DirPath)
 	if err := os.MkdirAll(walDir, 0755); err != nil {
+		fileLock.Unlock()
 		return nil, fmt.Errorf("failed to create WAL directory: %v", err)
 	}
 
+	// 磁盘索引文件放在数据目录中，持有目录锁后才能创建
+	curIndex, err := index.NewIndexWithOptions(config.IndexType, index.Options{
+		Dir:        config.DirPath,
+		CachePages: config.IndexCachePages,
+	})
+	if err != nil {
+		fileLock.Unlock()
+		return nil, err
+	}
+
 	db := &Bitcask{
 		config:   config,
 		olderWal: make(map[int64]*wal.WAL),
-		curIndex: index.NewIndex(config.IndexType),
+		curIndex: curIndex,
 		mu:       sync.RWMutex{},
 		fileId:   0,
 		fileIds:  make([]int64, 0),
+		fileLock: fileLock,
+		closeCh:  make(chan struct{}),
+		blobs:    make(map[int64]*wal.WAL),
+		pins:     make(map[*wal.WAL]int),
+		retired:  make(map[*wal.WAL]bool),
+
+		liveBytes: make(map[int64]int64),
 	}
+	db.batchSeq.Store(uint64(time.Now().UnixNano()))
 
 	// 初始化olderWal
 	if err := db.load(); err != nil {
-		return nil, fmt.Errorf("failed to load wal files: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to load wal files: %w", err)
 	}
 
 	// 如果当前没有活跃的wal，则创建一个新的wal
 	if db.activeWal == nil {
 		walFile := filepath.Join(getWalDir(config.DirPath), getWalFileName(db.fileId))
-		currWal, err := wal.NewWAL(walFile, db.fileId)
+		currWal, err := wal.NewWALWithOptions(walFile, db.fileId, db.walOptions())
 		if err != nil {
+			db.Close()
 			return nil, fmt.Errorf("failed to create new wal file %s: %v", walFile, err)
 		}
 		db.activeWal = currWal
 	}
 
+	if config.syncPolicy() == SyncInterval {
+		db.wg.Add(1)
+		go db.syncLoop()
+	}
+
 	return db, nil
 }
 
+// walOptions 根据配置生成wal的读写选项
+func (b *Bitcask) walOptions() wal.Options {
+	options := wal.Options{
+		BaseSeq: b.seq.Load(),
+
+		Compressor:        b.config.Compressor,
+		CompressThreshold: b.config.CompressThreshold,
+		MaxValueLength:    b.config.MaxValueLength,
+
+		Keys: b.config.Keys,
+
+		OnSync: b.metrics.observeSync,
+	}
+	switch b.config.syncPolicy() {
+	case SyncAlways:
+		options.SyncWrite = true
+	case SyncBytes:
+		options.BytesPerSync = b.config.BytesPerSync
+	}
+	return options
+}
+
+// checkKey 检查key是否合法
+func (b *Bitcask) checkKey(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if int64(len(key)) > record.MaxKeySize || (b.config.MaxKeyLength > 0 && int64(len(key)) > b.config.MaxKeyLength) {
+		return ErrKeyTooLarge
+	}
+	// 磁盘索引无法保存过长的key，必须在写入wal之前拒绝，否则下次启动时无法加载
+	if b.config.IndexType == "disk" && len(key) > index.DiskMaxKeySize {
+		return ErrKeyTooLarge
+	}
+	return nil
+}
+
+// checkValue 检查value是否合法
+func (b *Bitcask) checkValue(value []byte) error {
+	return b.checkValueSize(int64(len(value)))
+}
+
+// checkValueSize 检查value长度是否合法
+func (b *Bitcask) checkValueSize(size int64) error {
+	if size > record.MaxValueSize || (b.config.MaxValueLength > 0 && size > b.config.MaxValueLength) {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// syncLoop 后台定时同步活跃wal
+func (b *Bitcask) syncLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Sync()
+		case <-b.closeCh:
+			return
+		}
+	}
+}
+
+// Sync 将活跃wal中的数据同步到磁盘
+func (b *Bitcask) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.syncBlob(); err != nil {
+		return err
+	}
+	if err := b.activeWal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync active wal: %v", err)
+	}
+	return nil
+}
+
 func (b *Bitcask) load() error {
+	// 处理上次未完成的合并
+	if err := b.recoverMerge(); err != nil {
+		return fmt.Errorf("failed to recover merge: %v", err)
+	}
+	if err := b.loadBlobs(); err != nil {
+		return err
+	}
+
 	// 获取目录下所有WAL文件
 	walDir := getWalDir(b.config.DirPath)
 	files, err := os.ReadDir(walDir)
@@ -71,7 +237,7 @@ func (b *Bitcask) load() error {
 		if os.IsNotExist(err) {
 			// WAL目录不存在，这是正常的，创建一个新的WAL文件
 			walFile := filepath.Join(walDir, getWalFileName(0))
-			activeWal, err := wal.NewWAL(walFile, 0)
+			activeWal, err := wal.NewWALWithOptions(walFile, 0, b.walOptions())
 			if err != nil {
 				return fmt.Errorf("failed to create initial WAL file: %v", err)
 			}
@@ -87,17 +253,12 @@ func (b *Bitcask) load() error {
 			continue // 跳过目录
 		}
 
-		name := file.Name()
-		if !strings.HasPrefix(name, "data_") || !strings.HasSuffix(name, ".wal") {
-			continue
-		}
-
-		fileIdStr := strings.TrimPrefix(name, "data_")
-		fileIdStr = strings.TrimSuffix(fileIdStr, ".wal")
-
-		fileId, err := strconv.ParseInt(fileIdStr, 10, 64)
+		fileId, ok, err := parseWalFileId(file.Name())
 		if err != nil {
-			return fmt.Errorf("invalid wal file name %s: %v", name, err)
+			return err
+		}
+		if !ok {
+			continue
 		}
 
 		b.fileIds = append(b.fileIds, fileId)
@@ -106,7 +267,7 @@ func (b *Bitcask) load() error {
 	// 如果没有找到任何WAL文件，创建一个新的
 	if len(b.fileIds) == 0 {
 		walFile := filepath.Join(walDir, getWalFileName(0))
-		activeWal, err := wal.NewWAL(walFile, 0)
+		activeWal, err := wal.NewWALWithOptions(walFile, 0, b.walOptions())
 		if err != nil {
 			return fmt.Errorf("failed to create initial WAL file: %v", err)
 		}
@@ -119,21 +280,43 @@ func (b *Bitcask) load() error {
 		return b.fileIds[i] < b.fileIds[j]
 	})
 
-	// 打开所有WAL文件
+	// 打开所有WAL文件，加载时同时统计每个文件的有效数据
+	loadIndex := liveIndex{Index: b.curIndex, b: b}
 	for i, fileId := range b.fileIds {
 		walFile := filepath.Join(walDir, getWalFileName(fileId))
-		currWal, err := wal.NewWAL(walFile, fileId)
+		currWal, err := wal.NewWALWithOptions(walFile, fileId, b.walOptions())
 		if err != nil {
-			return fmt.Errorf("failed to open wal file %s: %v", walFile, err)
+			return fmt.Errorf("failed to open wal file %s: %w", walFile, err)
+		}
+		if i < len(b.fileIds)-1 {
+			// 已封存的文件优先使用hint文件加载
+			hintFile := filepath.Join(walDir, getHintFileName(fileId))
+			if err := currWal.LoadHint(hintFile, loadIndex); err == nil {
+				b.olderWal[fileId] = currWal
+				continue
+			}
 		}
-		if err := currWal.LoadWal(b.curIndex); err != nil {
-			return fmt.Errorf("failed to load wal file %s: %v", walFile, err)
+		if err := currWal.LoadWal(loadIndex); err != nil {
+			if err := b.recoverCorrupted(currWal, err, i == len(b.fileIds)-1); err != nil {
+				return fmt.Errorf("failed to load wal file %s: %v", walFile, err)
+			}
+		}
+
+		if currWal.MaxSeq() > b.seq.Load() {
+			b.seq.Store(currWal.MaxSeq())
 		}
 
-		if i == len(b.fileIds)-1 {
+		if i == len(b.fileIds)-1 && currWal.Version() == record.FormatV0 {
+			// 旧格式的文件不再追加写入，封存后由调用方创建新格式的活跃文件
+			b.writeHint(currWal)
+			b.olderWal[fileId] = currWal
+			b.fileId = fileId + 1
+		} else if i == len(b.fileIds)-1 {
 			b.activeWal = currWal
 			b.fileId = fileId
 		} else {
+			// hint文件缺失或损坏时重新生成
+			b.writeHint(currWal)
 			b.olderWal[fileId] = currWal
 		}
 	}
@@ -141,6 +324,50 @@ func (b *Bitcask) load() error {
 	return nil
 }
 
+// RecoveryReport 启动时截断损坏记录的结果
+type RecoveryReport struct {
+	FileID       int64 // 被截断的文件id
+	Offset       int64 // 截断位置
+	DroppedBytes int64 // 丢弃的字节数
+	Reason       error // 损坏原因
+}
+
+// recoverCorrupted 按恢复策略处理加载时遇到的损坏记录，无法恢复时返回原始错误
+func (b *Bitcask) recoverCorrupted(w *wal.WAL, err error, newest bool) error {
+	var corrupted *wal.CorruptedError
+	if !errors.As(err, &corrupted) {
+		return err
+	}
+	switch b.config.RecoveryPolicy {
+	case RecoveryStrict:
+		return err
+	case RecoveryTruncateTail:
+		if !newest {
+			return err
+		}
+	}
+
+	// 截断到最后一条有效记录
+	if err := w.Truncate(corrupted.Offset); err != nil {
+		return fmt.Errorf("failed to truncate corrupted wal file: %v", err)
+	}
+	if err := w.Sync(); err != nil {
+		return fmt.Errorf("failed to sync truncated wal file: %v", err)
+	}
+	b.recovery = append(b.recovery, RecoveryReport{
+		FileID:       corrupted.FileID,
+		Offset:       corrupted.Offset,
+		DroppedBytes: corrupted.FileSize - corrupted.Offset,
+		Reason:       corrupted.Err,
+	})
+	return nil
+}
+
+// Recovery 返回启动时截断损坏记录的结果
+func (b *Bitcask) Recovery() []RecoveryReport {
+	return b.recovery
+}
+
 // getWalDir 获取WAL目录路径
 func getWalDir(dirPath string) string {
 	return filepath.Join(dirPath, "data_wal")
@@ -151,9 +378,47 @@ func getWalFileName(fileId int64) string {
 	return fmt.Sprintf("data_%09d.wal", fileId)
 }
 
+// getHintFileName 获取hint文件名
+func getHintFileName(fileId int64) string {
+	return fmt.Sprintf("data_%09d.hint", fileId)
+}
+
+// writeHint 为已封存的wal文件写入hint文件，
+// hint文件只用于加速启动，写入失败时下次启动会回退到全量扫描
+func (b *Bitcask) writeHint(w *wal.WAL) {
+	hintFile := filepath.Join(getWalDir(b.config.DirPath), getHintFileName(w.GetFileID()))
+	if err := w.WriteHint(hintFile); err != nil {
+		w.DiscardHint()
+	}
+}
+
+// parseWalFileId 从WAL文件名中解析文件id，不是WAL文件时返回false
+func parseWalFileId(name string) (int64, bool, error) {
+	return parseFileId(name, ".wal")
+}
+
+// parseHintFileId 从hint文件名中解析文件id，不是hint文件时返回false
+func parseHintFileId(name string) (int64, bool, error) {
+	return parseFileId(name, ".hint")
+}
+
+func parseFileId(name string, ext string) (int64, bool, error) {
+	if !strings.HasPrefix(name, "data_") || !strings.HasSuffix(name, ext) {
+		return 0, false, nil
+	}
+
+	fileIdStr := strings.TrimPrefix(name, "data_")
+	fileIdStr = strings.TrimSuffix(fileIdStr, ext)
+
+	fileId, err := strconv.ParseInt(fileIdStr, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid data file name %s: %v", name, err)
+	}
+	return fileId, true, nil
+}
+
+// getWalFile 根据文件id获取wal文件，调用方需持有读锁或写锁
 func (b *Bitcask) getWalFile(fileId int64) (*wal.WAL, error) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
 	if fileId == b.fileId {
 		return b.activeWal, nil
 	}
@@ -164,40 +429,81 @@ func (b *Bitcask) getWalFile(fileId int64) (*wal.WAL, error) {
 	return targetWal, nil
 }
 
+// checkOverFlow 检查活跃文件是否超出大小限制，调用方需持有锁
 func (b *Bitcask) checkOverFlow() bool {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
 	return b.activeWal.GetOffset() > b.config.MaxFileSize
 }
 
+// tryCreateNewWalFile 活跃文件写满时封存并创建新的wal文件，调用方需持有写锁
 func (b *Bitcask) tryCreateNewWalFile() error {
-
 	if !b.checkOverFlow() {
 		return nil
 	}
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	if err := b.syncBlob(); err != nil {
+		return err
+	}
 	if err := b.activeWal.Sync(); err != nil {
 		return fmt.Errorf("failed to sync active wal: %v", err)
 	}
+	b.writeHint(b.activeWal)
 	b.olderWal[b.fileId] = b.activeWal
 	b.fileId++
 	walFile := filepath.Join(getWalDir(b.config.DirPath), getWalFileName(b.fileId))
-	newWal, err := wal.NewWAL(walFile, b.fileId)
+	newWal, err := wal.NewWALWithOptions(walFile, b.fileId, b.walOptions())
 	if err != nil {
 		return fmt.Errorf("failed to create new wal file %s: %v", walFile, err)
 	}
 	b.activeWal = newWal
+	b.metrics.walRotations.Add(1)
 
 	return nil
 }
 
 func (b *Bitcask) Put(key []byte, value []byte) error {
-	pos, err := b.activeWal.Append(key, value, record.RecordTypeNormal)
+	return b.put(key, value, 0)
+}
+
+// put 写入键值对，expireAt为0表示永不过期
+func (b *Bitcask) put(key []byte, value []byte, expireAt int64) (err error) {
+	start := time.Now()
+	defer func() {
+		b.metrics.put.observe(start, err != nil)
+	}()
+	if err := b.checkKey(key); err != nil {
+		return err
+	}
+	if err := b.checkValue(value); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.appendRecord(&record.Header{
+		Key:        key,
+		Value:      value,
+		RecordType: record.RecordTypeNormal,
+		ExpireAt:   expireAt,
+	})
+}
+
+// appendRecord 写入一条正常记录并更新索引，大value写入blob文件，调用方需持有写锁
+func (b *Bitcask) appendRecord(header *record.Header) error {
+	header.Seq = b.seq.Add(1)
+	header.Timestamp = time.Now().UnixNano()
+	header, err := b.separateValue(header)
+	if err != nil {
+		return err
+	}
+	return b.appendIndexed(header)
+}
+
+// appendIndexed 将记录写入活跃wal并更新索引，调用方需持有写锁
+func (b *Bitcask) appendIndexed(header *record.Header) error {
+	key := header.Key
+	pos, err := b.activeWal.AppendRecord(header)
 	if err != nil {
 		return fmt.Errorf("failed to append record to wal: %v", err)
 	}
-	if err := b.curIndex.Put(key, pos); err != nil {
+	if err := b.indexPut(key, pos); err != nil {
 		return fmt.Errorf("failed to put key to index: %v", err)
 	}
 	if err := b.tryCreateNewWalFile(); err != nil {
@@ -206,12 +512,25 @@ func (b *Bitcask) Put(key []byte, value []byte) error {
 	return nil
 }
 
-func (b *Bitcask) Del(key []byte) error {
-	_, err := b.activeWal.Append(key, nil, record.RecordTypeDeleted)
+func (b *Bitcask) Del(key []byte) (err error) {
+	start := time.Now()
+	defer func() {
+		b.metrics.del.observe(start, err != nil)
+	}()
+	if err := b.checkKey(key); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err = b.activeWal.AppendRecord(&record.Header{
+		Key:        key,
+		RecordType: record.RecordTypeDeleted,
+		Seq:        b.seq.Add(1),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to append record to wal: %v", err)
 	}
-	if err := b.curIndex.Delete(key); err != nil {
+	if err := b.indexDelete(key); err != nil {
 		return fmt.Errorf("failed to delete key from index: %v", err)
 	}
 	if err := b.tryCreateNewWalFile(); err != nil {
@@ -220,11 +539,71 @@ func (b *Bitcask) Del(key []byte) error {
 	return nil
 }
 
-func (b *Bitcask) Get(key []byte) ([]byte, bool) {
+func (b *Bitcask) Get(key []byte) (value []byte, ok bool) {
+	start := time.Now()
+	var err error
+	defer func() {
+		b.metrics.get.observe(start, err != nil)
+		if !ok && err == nil {
+			b.metrics.getMisses.Add(1)
+		}
+	}()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	value, ok, err = b.lookup(key)
+	return value, ok
+}
+
+// lookup 读取key的value，key不存在、已删除或已过期时返回false，
+// 读取或解码失败时返回错误，调用方需持有读锁或写锁
+func (b *Bitcask) lookup(key []byte) ([]byte, bool, error) {
 	pos, err := b.curIndex.Get(key)
+	if errors.Is(err, index.ErrKeyNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	walFile, err := b.getWalFile(pos.FileID)
 	if err != nil {
+		return nil, false, err
+	}
+	header, err := walFile.ReadRecord(pos)
+	if err != nil {
+		return nil, false, err
+	}
+	if header.RecordType == record.RecordTypeDeleted || header.IsExpired(time.Now().UnixNano()) {
+		return nil, false, nil
+	}
+	if err := b.resolveBlob(header); err != nil {
+		return nil, false, err
+	}
+	return header.Value, true, nil
+}
+
+// readValue 读取位置信息对应的value，已过期的记录视为不存在，调用方需持有读锁或写锁
+func (b *Bitcask) readValue(pos *record.Pos) ([]byte, bool) {
+	header, ok := b.readRecord(pos)
+	if !ok {
 		return nil, false
 	}
+	return header.Value, true
+}
+
+// readRecord 读取位置信息对应的记录，value保存在blob文件中时读取blob，
+// 已过期的记录视为不存在，调用方需持有读锁或写锁
+func (b *Bitcask) readRecord(pos *record.Pos) (*record.Header, bool) {
+	header, ok := b.readStoredRecord(pos)
+	if !ok {
+		return nil, false
+	}
+	if err := b.resolveBlob(header); err != nil {
+		return nil, false
+	}
+	return header, true
+}
+
+// readStoredRecord 读取wal中保存的记录，不读取blob，调用方需持有读锁或写锁
+func (b *Bitcask) readStoredRecord(pos *record.Pos) (*record.Header, bool) {
 	if pos == nil {
 		return nil, false
 	}
@@ -232,40 +611,66 @@ func (b *Bitcask) Get(key []byte) ([]byte, bool) {
 	if err != nil {
 		return nil, false
 	}
-	value, err := walFile.ReadAt(pos.Offset, pos.Size)
-	if err != nil {
+	return readLiveRecord(walFile, pos, time.Now().UnixNano())
+}
+
+// readLiveRecord 读取wal中保存的记录，已删除或在now时已过期的记录视为不存在
+func readLiveRecord(walFile *wal.WAL, pos *record.Pos, now int64) (*record.Header, bool) {
+	header, err := walFile.ReadRecord(pos)
+	if err != nil || header.RecordType == record.RecordTypeDeleted {
 		return nil, false
 	}
-	header := record.FromBytes(value)
-	if header.RecordType == record.RecordTypeDeleted {
+	if header.IsExpired(now) {
 		return nil, false
 	}
-	return header.Value, true
+	return header, true
 }
 
+// Close 同步并关闭所有文件，释放目录锁，重复关闭时返回ErrClosed
 func (b *Bitcask) Close() error {
+	if !b.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	close(b.closeCh)
+	b.wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	for _, wal := range b.olderWal {
 		wal.Close()
 	}
-	b.activeWal.Close()
+	for w := range b.retired {
+		w.Close()
+	}
+	for _, blob := range b.blobs {
+		blob.Sync()
+		blob.Close()
+	}
+	if b.activeWal != nil {
+		// 关闭前同步，保证不主动刷盘的策略下数据也不会丢失
+		b.activeWal.Sync()
+		b.activeWal.Close()
+	}
+	if closer, ok := b.curIndex.(io.Closer); ok {
+		closer.Close()
+	}
+	if err := b.fileLock.Unlock(); err != nil {
+		return fmt.Errorf("failed to unlock data directory: %v", err)
+	}
 	return nil
 }
 func (b *Bitcask) Show() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	iter := b.curIndex.Iterator()
 	for ; iter.Valid(); iter.Next() {
 		key, pos := iter.Key(), iter.Value()
-		fmt.Println("key", string(key), "pos", pos)
-		walFile, err := b.getWalFile(pos.FileID)
-		if err != nil {
-			fmt.Println("failed to get wal file", err)
+		header, ok := b.readRecord(pos)
+		if !ok {
+			// 已过期或读取失败的记录视为不存在
 			continue
 		}
-		value, err := walFile.ReadAt(pos.Offset, pos.Size)
-		if err != nil {
-			fmt.Println("failed to read wal file", err)
-			continue
-		}
-		header := record.FromBytes(value)
+		fmt.Println("key", string(key), "pos", pos)
 		fmt.Println("header", header)
 	}
 }
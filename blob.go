@@ -0,0 +1,334 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+var ErrInvalidBlobPointer = errors.New("invalid blob pointer")
+
+// blob指针格式: fileId(8) offset(8) size(8)
+const blobPointerLength = 8 + 8 + 8
+
+// getBlobDir 获取blob目录路径
+func getBlobDir(dirPath string) string {
+	return filepath.Join(dirPath, "data_blob")
+}
+
+// getBlobFileName 获取blob文件名
+func getBlobFileName(fileId int64) string {
+	return fmt.Sprintf("data_%09d.blob", fileId)
+}
+
+// encodeBlobPointer 序列化blob指针
+func encodeBlobPointer(pos *record.Pos) []byte {
+	buf := make([]byte, blobPointerLength)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(pos.FileID))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(pos.Offset))
+	binary.BigEndian.PutUint64(buf[16:24], uint64(pos.Size))
+	return buf
+}
+
+// decodeBlobPointer 反序列化blob指针
+func decodeBlobPointer(buf []byte) (*record.Pos, error) {
+	if len(buf) != blobPointerLength {
+		return nil, ErrInvalidBlobPointer
+	}
+	return &record.Pos{
+		FileID: int64(binary.BigEndian.Uint64(buf[0:8])),
+		Offset: int64(binary.BigEndian.Uint64(buf[8:16])),
+		Size:   int64(binary.BigEndian.Uint64(buf[16:24])),
+	}, nil
+}
+
+// blobOptions blob文件的读写选项，blob文件不需要hint文件
+func (b *Bitcask) blobOptions() wal.Options {
+	options := b.walOptions()
+	options.DisableHint = true
+	return options
+}
+
+// blobFileSize 单个blob文件的最大大小
+func (b *Bitcask) blobFileSize() int64 {
+	if b.config.BlobFileSize > 0 {
+		return b.config.BlobFileSize
+	}
+	return b.config.MaxFileSize
+}
+
+// loadBlobs 打开所有blob文件，截断最新blob文件尾部写了一半的记录
+func (b *Bitcask) loadBlobs() error {
+	blobDir := getBlobDir(b.config.DirPath)
+	files, err := os.ReadDir(blobDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read blob directory: %v", err)
+	}
+
+	fileIds := make([]int64, 0)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		fileId, ok, err := parseFileId(file.Name(), ".blob")
+		if err != nil {
+			return err
+		}
+		if ok {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	sort.Slice(fileIds, func(i, j int) bool {
+		return fileIds[i] < fileIds[j]
+	})
+
+	for i, fileId := range fileIds {
+		blobFile := filepath.Join(blobDir, getBlobFileName(fileId))
+		blob, err := wal.NewWALWithOptions(blobFile, fileId, b.blobOptions())
+		if err != nil {
+			return fmt.Errorf("failed to open blob file %s: %w", blobFile, err)
+		}
+		b.blobs[fileId] = blob
+		if i == len(fileIds)-1 {
+			// blob文件中的记录在对应的指针记录之前写入，尾部损坏的记录不会被引用
+			err := blob.Iterate(func(header *record.Header, pos *record.Pos) error {
+				return nil
+			})
+			var corrupted *wal.CorruptedError
+			if errors.As(err, &corrupted) {
+				if err := blob.Truncate(corrupted.Offset); err != nil {
+					return fmt.Errorf("failed to truncate blob file %s: %v", blobFile, err)
+				}
+			} else if err != nil {
+				return fmt.Errorf("failed to load blob file %s: %w", blobFile, err)
+			}
+			b.activeBlob = blob
+			b.blobId = fileId
+		}
+	}
+	return nil
+}
+
+// separateValue value长度达到阈值时写入blob文件，返回只保存指针的记录，调用方需持有写锁
+func (b *Bitcask) separateValue(header *record.Header) (*record.Header, error) {
+	if b.config.BlobThreshold <= 0 || header.RecordType != record.RecordTypeNormal ||
+		int64(len(header.Value)) < b.config.BlobThreshold {
+		return header, nil
+	}
+	pos, err := b.appendBlob(header)
+	if err != nil {
+		return nil, err
+	}
+	separated := *header
+	separated.Value = encodeBlobPointer(pos)
+	separated.Flags |= record.FlagBlob
+	return &separated, nil
+}
+
+// appendBlob 将记录写入活跃blob文件，写满时切换到新的blob文件，调用方需持有写锁
+func (b *Bitcask) appendBlob(header *record.Header) (*record.Pos, error) {
+	blob, err := b.writableBlob()
+	if err != nil {
+		return nil, err
+	}
+	pos, err := blob.AppendRecord(&record.Header{
+		Key:        header.Key,
+		Value:      header.Value,
+		RecordType: record.RecordTypeNormal,
+		Seq:        header.Seq,
+		Timestamp:  header.Timestamp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to append record to blob file: %v", err)
+	}
+	return pos, nil
+}
+
+// writableBlob 返回可以写入的活跃blob文件，写满时切换到新的blob文件，调用方需持有写锁
+func (b *Bitcask) writableBlob() (*wal.WAL, error) {
+	if b.activeBlob == nil || b.activeBlob.GetOffset() > b.blobFileSize() {
+		if err := b.rotateBlob(); err != nil {
+			return nil, err
+		}
+	}
+	return b.activeBlob, nil
+}
+
+// rotateBlob 封存活跃blob文件并创建新的blob文件，调用方需持有写锁
+func (b *Bitcask) rotateBlob() error {
+	blobDir := getBlobDir(b.config.DirPath)
+	if b.activeBlob == nil {
+		if err := os.MkdirAll(blobDir, 0755); err != nil {
+			return fmt.Errorf("failed to create blob directory: %v", err)
+		}
+	} else {
+		if err := b.activeBlob.Sync(); err != nil {
+			return fmt.Errorf("failed to sync blob file: %v", err)
+		}
+		b.blobId++
+	}
+	blobFile := filepath.Join(blobDir, getBlobFileName(b.blobId))
+	blob, err := wal.NewWALWithOptions(blobFile, b.blobId, b.blobOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create blob file %s: %v", blobFile, err)
+	}
+	b.blobs[b.blobId] = blob
+	b.activeBlob = blob
+	return nil
+}
+
+// syncBlob 同步活跃blob文件，需要在同步指向它的wal文件之前调用
+func (b *Bitcask) syncBlob() error {
+	if b.activeBlob == nil {
+		return nil
+	}
+	if err := b.activeBlob.Sync(); err != nil {
+		return fmt.Errorf("failed to sync blob file: %v", err)
+	}
+	return nil
+}
+
+// resolveBlob 读取指针指向的value，调用方需持有读锁或写锁
+func (b *Bitcask) resolveBlob(header *record.Header) error {
+	return resolveBlobIn(b.blobs, header)
+}
+
+// resolveBlobIn 在blobs中读取指针指向的value
+func resolveBlobIn(blobs map[int64]*wal.WAL, header *record.Header) error {
+	if !header.Flags.Has(record.FlagBlob) {
+		return nil
+	}
+	pos, err := decodeBlobPointer(header.Value)
+	if err != nil {
+		return err
+	}
+	blob, ok := blobs[pos.FileID]
+	if !ok {
+		return fmt.Errorf("blob file %d not found", pos.FileID)
+	}
+	blobHeader, err := blob.ReadRecord(pos)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %v", err)
+	}
+	header.Value = blobHeader.Value
+	header.Flags &^= record.FlagBlob
+	return nil
+}
+
+// BlobGCResult blob垃圾回收的结果
+type BlobGCResult struct {
+	Files        int   // 回收的blob文件数
+	MovedRecords int   // 移动到新blob文件的有效记录数
+	FreedBytes   int64 // 释放的磁盘空间
+}
+
+// BlobGC 回收blob文件，无效数据比例达到BlobGCRatio的已封存blob文件中的有效value
+// 会被移动到活跃blob文件，并写入新的指针记录，之后删除旧的blob文件
+func (b *Bitcask) BlobGC() (BlobGCResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result BlobGCResult
+	fileIds := make([]int64, 0, len(b.blobs))
+	for fileId := range b.blobs {
+		if b.activeBlob == nil || fileId != b.activeBlob.GetFileID() {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	sort.Slice(fileIds, func(i, j int) bool {
+		return fileIds[i] < fileIds[j]
+	})
+
+	for _, fileId := range fileIds {
+		moved, freed, err := b.collectBlob(b.blobs[fileId])
+		if err != nil {
+			return result, fmt.Errorf("failed to collect blob file %d: %v", fileId, err)
+		}
+		if freed > 0 {
+			result.Files++
+			result.MovedRecords += moved
+			result.FreedBytes += freed
+		}
+	}
+	return result, nil
+}
+
+// liveBlob blob文件中仍被引用的记录
+type liveBlob struct {
+	header *record.Header // 指向blob的记录
+	pos    *record.Pos    // 指针记录在wal中的位置
+}
+
+// collectBlob 回收一个blob文件，返回移动的记录数和释放的字节数，调用方需持有写锁
+func (b *Bitcask) collectBlob(blob *wal.WAL) (int, int64, error) {
+	fileId := blob.GetFileID()
+	lives := make([]liveBlob, 0)
+	var liveBytes int64
+	err := blob.Iterate(func(header *record.Header, pos *record.Pos) error {
+		walPos, err := b.curIndex.Get(header.Key)
+		if err != nil {
+			return nil
+		}
+		walHeader, ok := b.readStoredRecord(walPos)
+		if !ok || !walHeader.Flags.Has(record.FlagBlob) {
+			return nil
+		}
+		ptr, err := decodeBlobPointer(walHeader.Value)
+		if err != nil || ptr.FileID != fileId || ptr.Offset != pos.Offset {
+			return nil
+		}
+		lives = append(lives, liveBlob{header: walHeader, pos: walPos})
+		liveBytes += pos.Size
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size := blob.GetOffset()
+	if size == 0 || float64(size-liveBytes)/float64(size) < b.config.BlobGCRatio {
+		return 0, 0, nil
+	}
+
+	// 先写入新的blob，同步后再写指针记录，保证指针不会指向不存在的数据
+	for _, live := range lives {
+		if err := b.resolveBlob(live.header); err != nil {
+			return 0, 0, err
+		}
+		pos, err := b.appendBlob(live.header)
+		if err != nil {
+			return 0, 0, err
+		}
+		live.header.Value = encodeBlobPointer(pos)
+		live.header.Flags |= record.FlagBlob
+	}
+	if err := b.syncBlob(); err != nil {
+		return 0, 0, err
+	}
+	for _, live := range lives {
+		live.header.Seq = b.seq.Add(1)
+		if err := b.appendIndexed(live.header); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := b.activeWal.Sync(); err != nil {
+		return 0, 0, fmt.Errorf("failed to sync active wal: %v", err)
+	}
+
+	b.retire(blob)
+	delete(b.blobs, fileId)
+	blobFile := filepath.Join(getBlobDir(b.config.DirPath), getBlobFileName(fileId))
+	if err := os.Remove(blobFile); err != nil {
+		return 0, 0, fmt.Errorf("failed to remove blob file: %v", err)
+	}
+	return len(lives), size - liveBytes, nil
+}
@@ -0,0 +1,131 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskBlob(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-blob-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:       dir,
+		MaxFileSize:   1024,
+		IndexType:     "btree",
+		BlobThreshold: 100,
+		BlobFileSize:  1024,
+		BlobGCRatio:   0.5,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	ma := make(map[string][]byte)
+	largeValue := func(i int, tag string) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%s-%03d|", tag, i)), 30)
+	}
+	check := func(db *Bitcask) {
+		for key, want := range ma {
+			value, ok := db.Get([]byte(key))
+			if !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+
+	var valueSize int64
+	for i := 0; i < 20; i++ {
+		key, value := utils.GenerateKey(i), largeValue(i, "v1")
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		ma[string(key)] = value
+		valueSize += int64(len(value))
+	}
+	if err := db.Put([]byte("small"), []byte("value")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	ma["small"] = []byte("value")
+
+	t.Run("Separated", func(t *testing.T) {
+		check(db)
+		if size := dirSize(t, getWalDir(dir)); size >= valueSize {
+			t.Fatalf("wal files should only contain pointers, got %d bytes", size)
+		}
+		if size := dirSize(t, getBlobDir(dir)); size < valueSize {
+			t.Fatalf("blob files should contain values, got %d bytes", size)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		err := db.Update(func(tx *Txn) error {
+			return tx.Put([]byte("txn"), largeValue(0, "txn"))
+		})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		ma["txn"] = largeValue(0, "txn")
+		check(db)
+	})
+
+	t.Run("GC", func(t *testing.T) {
+		// 覆盖和删除大部分key，旧的blob成为无效数据
+		for i := 0; i < 15; i++ {
+			key := utils.GenerateKey(i)
+			if i%3 == 0 {
+				if err := db.Del(key); err != nil {
+					t.Fatalf("failed to del: %v", err)
+				}
+				delete(ma, string(key))
+				continue
+			}
+			value := largeValue(i, "v2")
+			if err := db.Put(key, value); err != nil {
+				t.Fatalf("failed to put: %v", err)
+			}
+			ma[string(key)] = value
+		}
+		before := dirSize(t, getBlobDir(dir))
+		result, err := db.BlobGC()
+		if err != nil {
+			t.Fatalf("BlobGC failed: %v", err)
+		}
+		if result.Files == 0 || result.FreedBytes == 0 {
+			t.Fatalf("unexpected gc result: %+v", result)
+		}
+		if after := dirSize(t, getBlobDir(dir)); after >= before {
+			t.Fatalf("blob files should shrink after gc, %d -> %d", before, after)
+		}
+		check(db)
+	})
+
+	t.Run("Merge And Reopen", func(t *testing.T) {
+		if err := db.Merge(); err != nil {
+			t.Fatalf("failed to merge: %v", err)
+		}
+		check(db)
+		db.Close()
+
+		// 关闭分离后已有的blob仍然可以读取
+		plain := *conf
+		plain.BlobThreshold = 0
+		reopened, err := NewBitcask(&plain)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		db = reopened
+		check(db)
+	})
+}
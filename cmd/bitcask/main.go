@@ -0,0 +1,194 @@
+// bitcask 命令行工具
+//
+//	bitcask export -dir ./data [-o dump.jsonl] [-key 1:<hex>]
+//	bitcask import -dir ./data [-i dump.jsonl] [-batch 1000] [-key 1:<hex>]
+//
+// 加密的数据库需要通过-key传入密钥，格式为"密钥id:十六进制密钥"，
+// 可以重复指定多个，最后一个作为当前密钥，其余只用于解密旧文件
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xia-Sang/bitcask"
+	"github.com/xia-Sang/bitcask/encrypt"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bitcask <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  export  将所有键值对以JSON Lines格式导出")
+	fmt.Fprintln(os.Stderr, "  import  导入export导出的JSON Lines")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// keyFlag 可重复指定的-key参数
+type keyFlag []string
+
+func (k *keyFlag) String() string { return strings.Join(*k, ",") }
+
+func (k *keyFlag) Set(v string) error {
+	*k = append(*k, v)
+	return nil
+}
+
+// keyRing 解析-key参数，没有指定时返回nil表示不加密
+func (k keyFlag) keyRing() (*encrypt.KeyRing, error) {
+	if len(k) == 0 {
+		return nil, nil
+	}
+	ring := encrypt.NewKeyRing()
+	for i, v := range k {
+		idStr, keyHex, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key %q: expected id:hex", v)
+		}
+		id, err := strconv.ParseUint(idStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key id %q: %v", idStr, err)
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %v", id, err)
+		}
+		add := ring.AddKey
+		if i == len(k)-1 {
+			add = ring.Rotate
+		}
+		if err := add(uint16(id), key); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// openDB 使用默认配置打开数据目录
+func openDB(dir, indexType string, keys keyFlag) (*bitcask.Bitcask, error) {
+	conf := bitcask.NewConfig()
+	conf.DirPath = dir
+	conf.IndexType = indexType
+	ring, err := keys.keyRing()
+	if err != nil {
+		return nil, err
+	}
+	if ring != nil {
+		conf.Keys = ring
+	}
+	return bitcask.NewBitcask(conf)
+}
+
+// closeDB 关闭数据库，没有其他错误时返回关闭的错误
+func closeDB(db *bitcask.Bitcask, err *error) {
+	if cerr := db.Close(); cerr != nil && *err == nil {
+		*err = cerr
+	}
+}
+
+func runExport(args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", "./data", "数据目录")
+	indexType := fs.String("index", "btree", "索引类型")
+	output := fs.String("o", "-", "输出文件，-表示标准输出")
+	var keys keyFlag
+	fs.Var(&keys, "key", "加密密钥，格式为id:hex，可重复指定")
+	fs.Parse(args)
+
+	db, err := openDB(*dir, *indexType, keys)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db, &err)
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *output != "-" {
+		f, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	count, err := db.Export(w)
+	if err != nil {
+		return err
+	}
+	// 输出文件落盘并关闭成功后才算导出完成，设备和管道不支持Sync
+	if f != nil {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d records\n", count)
+	return nil
+}
+
+func runImport(args []string) (err error) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := fs.String("dir", "./data", "数据目录")
+	indexType := fs.String("index", "btree", "索引类型")
+	input := fs.String("i", "-", "输入文件，-表示标准输入")
+	batchSize := fs.Int("batch", bitcask.DefaultImportBatchSize, "每个批量写入包含的记录数")
+	var keys keyFlag
+	fs.Var(&keys, "key", "加密密钥，格式为id:hex，可重复指定")
+	fs.Parse(args)
+
+	db, err := openDB(*dir, *indexType, keys)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db, &err)
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	count, err := db.Import(r, bitcask.ImportOptions{BatchSize: *batchSize})
+	if err != nil {
+		return fmt.Errorf("imported %d records before error: %v", count, err)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d records\n", count)
+	return nil
+}
@@ -0,0 +1,126 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrUnknownCompressor = errors.New("unknown compressor")
+	ErrTooLarge          = errors.New("decompressed data is too large")
+)
+
+// 内置压缩算法的id，0保留表示不压缩，自定义算法建议使用128以上的id
+const (
+	FlateID byte = 1
+	GzipID  byte = 2
+)
+
+// Compressor 值压缩算法，id会写入记录中，读取时根据id选择解压算法。
+// 解压后的长度超过limit时返回ErrTooLarge，避免损坏或恶意的数据解压出过长的内容
+type Compressor interface {
+	ID() byte
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte, limit int64) ([]byte, error)
+}
+
+// NewCompressor 根据名称创建内置的压缩算法
+func NewCompressor(typ string) (Compressor, error) {
+	switch typ {
+	case "flate":
+		return &Flate{Level: flate.DefaultCompression}, nil
+	case "gzip":
+		return &Gzip{Level: gzip.DefaultCompression}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCompressor, typ)
+}
+
+// Lookup 根据id查找内置的压缩算法
+func Lookup(id byte) (Compressor, error) {
+	switch id {
+	case FlateID:
+		return &Flate{Level: flate.DefaultCompression}, nil
+	case GzipID:
+		return &Gzip{Level: gzip.DefaultCompression}, nil
+	}
+	return nil, fmt.Errorf("%w: id %d", ErrUnknownCompressor, id)
+}
+
+// Flate deflate压缩
+type Flate struct {
+	Level int // 压缩级别
+}
+
+func (f *Flate) ID() byte {
+	return FlateID
+}
+
+func (f *Flate) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, f.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *Flate) Decompress(src []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readLimited(r, limit)
+}
+
+// Gzip gzip压缩
+type Gzip struct {
+	Level int // 压缩级别
+}
+
+func (g *Gzip) ID() byte {
+	return GzipID
+}
+
+func (g *Gzip) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, g.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *Gzip) Decompress(src []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, limit)
+}
+
+// readLimited 读取解压后的全部内容，超出limit时返回ErrTooLarge
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrTooLarge, limit)
+	}
+	return data, nil
+}
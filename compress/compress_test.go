@@ -0,0 +1,66 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"name":"bitcask","value":12345}`), 64)
+
+	for _, typ := range []string{"flate", "gzip"} {
+		t.Run(typ, func(t *testing.T) {
+			c, err := NewCompressor(typ)
+			if err != nil {
+				t.Fatalf("NewCompressor failed: %v", err)
+			}
+			compressed, err := c.Compress(data)
+			if err != nil {
+				t.Fatalf("Compress failed: %v", err)
+			}
+			if len(compressed) >= len(data) {
+				t.Errorf("compressed size %d should be smaller than %d", len(compressed), len(data))
+			}
+
+			// 根据id查找的算法可以解压
+			d, err := Lookup(c.ID())
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			result, err := d.Decompress(compressed, int64(len(data)))
+			if err != nil {
+				t.Fatalf("Decompress failed: %v", err)
+			}
+			if !bytes.Equal(result, data) {
+				t.Error("decompressed data mismatch")
+			}
+		})
+	}
+
+	t.Run("Too Large", func(t *testing.T) {
+		for _, typ := range []string{"flate", "gzip"} {
+			c, _ := NewCompressor(typ)
+			compressed, _ := c.Compress(data)
+			if _, err := c.Decompress(compressed, int64(len(data))-1); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("%s: expected ErrTooLarge, got %v", typ, err)
+			}
+		}
+		for _, typ := range []string{"flate", "gzip"} {
+			c, _ := NewCompressor(typ)
+			compressed, _ := c.Compress(data)
+			if result, err := c.Decompress(compressed, int64(len(data))); err != nil || !bytes.Equal(result, data) {
+				t.Errorf("%s: decompress at the limit failed: %v", typ, err)
+			}
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		if _, err := NewCompressor("zstd"); !errors.Is(err, ErrUnknownCompressor) {
+			t.Errorf("expected ErrUnknownCompressor, got %v", err)
+		}
+		if _, err := Lookup(0); !errors.Is(err, ErrUnknownCompressor) {
+			t.Errorf("expected ErrUnknownCompressor, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/compress"
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+// lossyCompressor 测试用的自定义压缩算法，只能压缩不能解压
+type lossyCompressor struct{}
+
+func (lossyCompressor) ID() byte { return 200 }
+
+func (lossyCompressor) Compress(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src)/2)
+	for i := len(src) - 1; i >= 0; i -= 2 {
+		dst = append(dst, src[i])
+	}
+	return dst, nil
+}
+
+func (lossyCompressor) Decompress(src []byte, limit int64) ([]byte, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestBitcaskCompression(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-compress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flate, err := compress.NewCompressor("flate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &Config{
+		DirPath:           dir,
+		MaxFileSize:       4096,
+		IndexType:         "btree",
+		Compressor:        flate,
+		CompressThreshold: 64,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+
+	ma := make(map[string][]byte)
+	var rawSize int
+	for i := 0; i < 50; i++ {
+		key := utils.GenerateKey(i)
+		value := bytes.Repeat([]byte(fmt.Sprintf(`{"id":%d,"name":"bitcask"}`, i)), 20)
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		ma[string(key)] = value
+		rawSize += len(value)
+	}
+	// 小于阈值的value不压缩
+	if err := db.Put([]byte("small"), []byte("tiny")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	ma["small"] = []byte("tiny")
+
+	check := func(db *Bitcask) {
+		for key, want := range ma {
+			value, ok := db.Get([]byte(key))
+			if !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		check(db)
+		if size := dirSize(t, getWalDir(dir)); size >= int64(rawSize) {
+			t.Fatalf("data files should be compressed, got %d bytes for %d bytes of values", size, rawSize)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		for i := 0; i < 25; i++ {
+			key := utils.GenerateKey(i)
+			value := bytes.Repeat([]byte(fmt.Sprintf(`{"id":%d,"name":"merged"}`, i)), 20)
+			if err := db.Put(key, value); err != nil {
+				t.Fatalf("failed to put: %v", err)
+			}
+			ma[string(key)] = value
+		}
+		if err := db.Merge(); err != nil {
+			t.Fatalf("failed to merge: %v", err)
+		}
+		check(db)
+		db.Close()
+	})
+
+	t.Run("Reopen Without Compressor", func(t *testing.T) {
+		// 内置算法写入的数据不需要配置也能读取
+		plain := *conf
+		plain.Compressor = nil
+		db, err := NewBitcask(&plain)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		check(db)
+		db.Close()
+	})
+
+	t.Run("Decompress Limit", func(t *testing.T) {
+		// 解压后超过配置上限的value读取失败，但不视为损坏截断文件，恢复配置后可以正常读取
+		limited := *conf
+		limited.MaxValueLength = 100
+		if db, err := NewBitcask(&limited); err == nil {
+			if _, ok := db.Get(utils.GenerateKey(0)); ok {
+				t.Fatal("Get should fail when the value exceeds MaxValueLength")
+			}
+			db.Close()
+		} else if !strings.Contains(err.Error(), compress.ErrTooLarge.Error()) {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		check(db)
+		db.Close()
+	})
+
+	t.Run("Custom Compressor", func(t *testing.T) {
+		custom := *conf
+		custom.Compressor = lossyCompressor{}
+		db, err := NewBitcask(&custom)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		if err := db.Put([]byte("custom"), bytes.Repeat([]byte("x"), 100)); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		if _, ok := db.Get([]byte("custom")); ok {
+			t.Fatal("Get should fail when decompression fails")
+		}
+		db.Close()
+
+		// 缺少自定义算法时不能把记录当作损坏截断
+		newest, err := filepath.Glob(filepath.Join(getWalDir(dir), "*.wal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := fileSize(t, newest[len(newest)-1])
+		if _, err := NewBitcask(conf); err == nil {
+			t.Fatal("expected error for unknown compressor")
+		}
+		if after := fileSize(t, newest[len(newest)-1]); after != before {
+			t.Fatalf("wal file should not be truncated, size %d -> %d", before, after)
+		}
+	})
+}
@@ -1,12 +1,54 @@
 package bitcask
 
+import (
+	"time"
+
+	"github.com/xia-Sang/bitcask/compress"
+	"github.com/xia-Sang/bitcask/encrypt"
+)
+
+// SyncPolicy 刷盘策略
+type SyncPolicy int
+
+const (
+	SyncDefault  SyncPolicy = iota // 由SyncWrite决定：true时每次写入同步，false时不主动同步
+	SyncAlways                     // 每次写入都同步
+	SyncInterval                   // 后台每隔SyncInterval同步一次
+	SyncBytes                      // 每写入BytesPerSync字节同步一次
+	SyncNever                      // 不主动同步，由操作系统刷盘
+)
+
+// RecoveryPolicy 启动时遇到损坏记录的处理策略
+type RecoveryPolicy int
+
+const (
+	RecoveryTruncateTail RecoveryPolicy = iota // 截断最新文件尾部的损坏记录，已封存文件损坏时报错
+	RecoveryStrict                             // 任何损坏都报错
+	RecoveryTruncateAll                        // 截断所有文件中损坏记录之后的数据
+)
+
 type Config struct {
-	DirPath        string // 数据存储目录
-	MaxFileSize    int64  // 单个文件最大大小
-	MaxKeyLength   int64  // 单个key最大长度
-	MaxValueLength int64  // 单个value最大长度
-	SyncWrite      bool   // 是否同步写入
-	IndexType      string // 索引类型
+	DirPath        string         // 数据存储目录
+	MaxFileSize    int64          // 单个文件最大大小
+	MaxKeyLength   int64          // 单个key最大长度
+	MaxValueLength int64          // 单个value最大长度，也是解压value的上限，调小后超出上限的已压缩value无法读取，调回后恢复
+	SyncWrite      bool           // 是否同步写入
+	SyncPolicy     SyncPolicy     // 刷盘策略
+	SyncInterval   time.Duration  // SyncInterval策略下的同步间隔
+	BytesPerSync   int64          // SyncBytes策略下的同步字节数
+	IndexType      string         // 索引类型：btree、art、skiplist、hash或disk
+	RecoveryPolicy RecoveryPolicy // 损坏记录处理策略
+
+	IndexCachePages int // disk索引在内存中缓存的页数，0表示使用默认值
+
+	Compressor        compress.Compressor // value压缩算法，nil表示不压缩
+	CompressThreshold int64               // value长度达到该值时才压缩
+
+	Keys encrypt.KeyProvider // 加密密钥，nil表示不加密；已加密的文件需要对应的密钥才能打开
+
+	BlobThreshold int64   // value长度达到该值时写入blob文件，0表示不分离
+	BlobFileSize  int64   // 单个blob文件最大大小，0表示与MaxFileSize相同
+	BlobGCRatio   float64 // blob文件中无效数据比例达到该值时才回收
 }
 
 func NewConfig() *Config {
@@ -16,6 +58,27 @@ func NewConfig() *Config {
 		MaxKeyLength:   1024,
 		MaxValueLength: 1024 * 1024, // 1MB
 		SyncWrite:      true,
+		SyncPolicy:     SyncDefault,
+		SyncInterval:   time.Second,
+		BytesPerSync:   1024 * 1024, // 1MB
 		IndexType:      "btree",
+		RecoveryPolicy: RecoveryTruncateTail,
+
+		CompressThreshold: 1024, // 1KB
+
+		BlobThreshold: 64 * 1024, // 64KB
+		BlobFileSize:  1024 * 1024 * 1024,
+		BlobGCRatio:   0.5,
+	}
+}
+
+// syncPolicy 返回实际生效的刷盘策略
+func (c *Config) syncPolicy() SyncPolicy {
+	if c.SyncPolicy != SyncDefault {
+		return c.SyncPolicy
+	}
+	if c.SyncWrite {
+		return SyncAlways
 	}
+	return SyncNever
 }
@@ -0,0 +1,99 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("encryption key not found")
+	ErrInvalidKey   = errors.New("invalid encryption key")
+	ErrNoCurrentKey = errors.New("no current encryption key")
+)
+
+// KeyProvider 提供加密密钥，新文件使用当前密钥加密，
+// 文件头中记录密钥id，读取旧文件时根据id获取对应的密钥
+type KeyProvider interface {
+	CurrentKey() (id uint16, key []byte, err error)
+	Key(id uint16) ([]byte, error)
+}
+
+// KeyRing 保存在内存中的密钥集合，轮换密钥后旧密钥仍然保留用于解密
+type KeyRing struct {
+	mu         sync.RWMutex
+	keys       map[uint16][]byte
+	current    uint16
+	hasCurrent bool
+}
+
+// NewKeyRing 创建空的密钥集合
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: make(map[uint16][]byte),
+	}
+}
+
+// AddKey 添加一个只用于解密的密钥，密钥长度必须为16、24或32字节
+func (r *KeyRing) AddKey(id uint16, key []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// Rotate 添加密钥并将其设置为当前密钥，之后创建的文件使用新密钥加密
+func (r *KeyRing) Rotate(id uint16, key []byte) error {
+	if err := r.AddKey(id, key); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = id
+	r.hasCurrent = true
+	return nil
+}
+
+func (r *KeyRing) CurrentKey() (uint16, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.hasCurrent {
+		return 0, nil, ErrNoCurrentKey
+	}
+	return r.current, r.keys[r.current], nil
+}
+
+func (r *KeyRing) Key(id uint16) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// NewAEAD 使用密钥创建AES-GCM
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func checkKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("%w: key length %d", ErrInvalidKey, len(key))
+}
@@ -0,0 +1,48 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestKeyRing(t *testing.T) {
+	ring := NewKeyRing()
+	if _, _, err := ring.CurrentKey(); !errors.Is(err, ErrNoCurrentKey) {
+		t.Fatalf("expected ErrNoCurrentKey, got %v", err)
+	}
+	if err := ring.AddKey(1, []byte("short")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+	if err := ring.Rotate(1, key1); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := ring.Rotate(2, key2); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	// 轮换后当前密钥为新密钥，旧密钥仍然可以获取
+	id, key, err := ring.CurrentKey()
+	if err != nil || id != 2 || !bytes.Equal(key, key2) {
+		t.Fatalf("CurrentKey mismatch: id=%d err=%v", id, err)
+	}
+	if key, err := ring.Key(1); err != nil || !bytes.Equal(key, key1) {
+		t.Fatalf("Key mismatch: err=%v", err)
+	}
+	if _, err := ring.Key(3); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	aead, err := NewAEAD(key1)
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, nonce, []byte("value"), nil)
+	if plain, err := aead.Open(nil, nonce, sealed, nil); err != nil || !bytes.Equal(plain, []byte("value")) {
+		t.Fatalf("Open failed: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/encrypt"
+	"github.com/xia-Sang/bitcask/utils"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+func TestBitcaskEncryption(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-encrypt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	ring := encrypt.NewKeyRing()
+	if err := ring.Rotate(1, key1); err != nil {
+		t.Fatal(err)
+	}
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+		Keys:        ring,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+
+	ma := make(map[string][]byte)
+	put := func(db *Bitcask, from, to int) {
+		for i := from; i < to; i++ {
+			key, value := utils.GenerateKey(i), []byte("secret-value")
+			if err := db.Put(key, value); err != nil {
+				t.Fatalf("failed to put: %v", err)
+			}
+			ma[string(key)] = value
+		}
+	}
+	check := func(db *Bitcask) {
+		for key, want := range ma {
+			value, ok := db.Get([]byte(key))
+			if !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+	put(db, 0, 30)
+	wb := db.NewBatch()
+	wb.Put([]byte("batch"), []byte("secret-value"))
+	if err := wb.Commit(); err != nil {
+		t.Fatalf("failed to commit batch: %v", err)
+	}
+	ma["batch"] = []byte("secret-value")
+	check(db)
+	db.Close()
+
+	t.Run("No Plaintext", func(t *testing.T) {
+		files, err := filepath.Glob(filepath.Join(getWalDir(dir), "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("secret-value")) || bytes.Contains(data, utils.GenerateKey(0)) {
+				t.Fatalf("file %s contains plaintext", file)
+			}
+		}
+	})
+
+	t.Run("Key Rotation", func(t *testing.T) {
+		// 轮换密钥后旧文件仍然可以读取
+		if err := ring.Rotate(2, key2); err != nil {
+			t.Fatal(err)
+		}
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		put(db, 30, 60)
+		check(db)
+		if db.activeWal.Header().KeyID != 2 {
+			t.Fatalf("new file should use the current key, got key id %d", db.activeWal.Header().KeyID)
+		}
+
+		// 合并后所有已封存的文件使用新密钥
+		if err := db.Merge(); err != nil {
+			t.Fatalf("failed to merge: %v", err)
+		}
+		check(db)
+		db.Close()
+
+		onlyNew := encrypt.NewKeyRing()
+		if err := onlyNew.Rotate(2, key2); err != nil {
+			t.Fatal(err)
+		}
+		newConf := *conf
+		newConf.Keys = onlyNew
+		db, err = NewBitcask(&newConf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask with new key only: %v", err)
+		}
+		check(db)
+		db.Close()
+	})
+
+	t.Run("Missing Key", func(t *testing.T) {
+		plain := *conf
+		plain.Keys = nil
+		if _, err := NewBitcask(&plain); !errors.Is(err, encrypt.ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Wrong Key", func(t *testing.T) {
+		wals, err := filepath.Glob(filepath.Join(getWalDir(dir), "*.wal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newest := wals[len(wals)-1]
+		before := fileSize(t, newest)
+
+		// 密钥错误时报错，不能把记录当作损坏截断
+		wrong := encrypt.NewKeyRing()
+		if err := wrong.Rotate(2, key1); err != nil {
+			t.Fatal(err)
+		}
+		wrongConf := *conf
+		wrongConf.Keys = wrong
+		if _, err := NewBitcask(&wrongConf); !errors.Is(err, wal.ErrWrongKey) {
+			t.Fatalf("expected ErrWrongKey, got %v", err)
+		}
+		if after := fileSize(t, newest); after != before {
+			t.Fatalf("wal file should not be truncated, size %d -> %d", before, after)
+		}
+	})
+
+	t.Run("Tampered Record", func(t *testing.T) {
+		wals, err := filepath.Glob(filepath.Join(getWalDir(dir), "*.wal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newest := wals[len(wals)-1]
+		data, err := os.ReadFile(newest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		if err := os.WriteFile(newest, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// 认证失败的记录按损坏处理
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		defer db.Close()
+		reports := db.Recovery()
+		if len(reports) != 1 || !errors.Is(reports[0].Reason, wal.ErrDecrypt) {
+			t.Fatalf("unexpected recovery report: %+v", reports)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// DefaultImportBatchSize 导入时每个批量写入包含的默认记录数
+const DefaultImportBatchSize = 1000
+
+// ExportRecord 导出文件中的一行，key和value使用base64编码
+type ExportRecord struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	ExpireAt  int64  `json:"expire_at,omitempty"` // 过期时间(UnixNano)，0表示永不过期
+	Seq       uint64 `json:"seq,omitempty"`       // 记录序列号，导入时不保留
+	Timestamp int64  `json:"timestamp,omitempty"` // 写入时间(UnixNano)，导入时不保留
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	BatchSize int // 每个批量写入包含的记录数，0表示使用DefaultImportBatchSize
+}
+
+// Export 将当前所有有效的键值对按key的顺序以JSON Lines格式写入w，返回导出的数量。
+// 导出基于快照，导出期间的写入不会出现在结果中
+func (b *Bitcask) Export(w io.Writer) (int, error) {
+	snap := b.Snapshot()
+	defer snap.Release()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	it := snap.Scan(nil, nil, ScanOptions{})
+	defer it.Close()
+
+	count := 0
+	for ; it.Valid(); it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return count, fmt.Errorf("failed to read value of key %q: %v", it.Key(), err)
+		}
+		err = enc.Encode(&ExportRecord{
+			Key:       it.Key(),
+			Value:     value,
+			ExpireAt:  it.header.ExpireAt,
+			Seq:       it.header.Seq,
+			Timestamp: it.header.Timestamp,
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to write export: %v", err)
+		}
+		count++
+	}
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write export: %v", err)
+	}
+	return count, nil
+}
+
+// Import 从r中读取Export导出的JSON Lines并分批写入，返回导入的数量。
+// 已过期的记录被跳过，每个批量写入单独提交，出错时已提交的批量写入不会回滚
+func (b *Bitcask) Import(r io.Reader, opts ImportOptions) (int, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	batch, pending, count := b.NewBatch(), 0, 0
+	for line := 1; ; line++ {
+		var rec ExportRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return count, fmt.Errorf("invalid record at line %d: %v", line, err)
+		}
+		if record.IsExpired(rec.ExpireAt, time.Now().UnixNano()) {
+			continue
+		}
+		if err := batch.putExpireAt(rec.Key, rec.Value, rec.ExpireAt); err != nil {
+			return count, fmt.Errorf("invalid record at line %d: %w", line, err)
+		}
+		if pending++; pending == batchSize {
+			if err := batch.Commit(); err != nil {
+				return count, err
+			}
+			count += pending
+			batch, pending = b.NewBatch(), 0
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return count, err
+	}
+	return count + pending, nil
+}
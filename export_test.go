@@ -0,0 +1,115 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskExportImport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-export-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newDB := func(t *testing.T, name string) *Bitcask {
+		db, err := NewBitcask(&Config{
+			DirPath:       filepath.Join(dir, name),
+			MaxFileSize:   1024,
+			IndexType:     "btree",
+			BlobThreshold: 100,
+		})
+		if err != nil {
+			t.Fatalf("failed to create bitcask: %v", err)
+		}
+		return db
+	}
+
+	src := newDB(t, "src")
+	defer src.Close()
+	ma := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		key, value := utils.GenerateKey(i), []byte(fmt.Sprintf("value-%d", i))
+		if i%10 == 0 {
+			value = bytes.Repeat(value, 20)
+		}
+		src.Put(key, value)
+		ma[string(key)] = value
+	}
+	binary := []byte{0x00, 0xff, '\n', '"'}
+	src.Put(binary, binary)
+	ma[string(binary)] = binary
+	src.PutWithTTL([]byte("ttl"), []byte("value"), time.Hour)
+	ma["ttl"] = []byte("value")
+	src.PutWithTTL([]byte("expired"), []byte("value"), time.Millisecond)
+	src.Del(utils.GenerateKey(1))
+	delete(ma, string(utils.GenerateKey(1)))
+	time.Sleep(5 * time.Millisecond)
+
+	var dump bytes.Buffer
+	t.Run("Export", func(t *testing.T) {
+		count, err := src.Export(&dump)
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(dump.String()), "\n")
+		if count != len(ma) || len(lines) != len(ma) {
+			t.Fatalf("export count mismatch: count=%d lines=%d want %d", count, len(lines), len(ma))
+		}
+		for _, line := range lines {
+			var rec ExportRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("invalid line %q: %v", line, err)
+			}
+			if rec.Seq == 0 || rec.Timestamp == 0 {
+				t.Fatalf("metadata missing: %q", line)
+			}
+			if (string(rec.Key) == "ttl") != (rec.ExpireAt != 0) {
+				t.Fatalf("expire_at mismatch: %q", line)
+			}
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		dst := newDB(t, "dst")
+		defer dst.Close()
+		count, err := dst.Import(bytes.NewReader(dump.Bytes()), ImportOptions{BatchSize: 7})
+		if err != nil || count != len(ma) {
+			t.Fatalf("Import mismatch: %d %v", count, err)
+		}
+		for key, want := range ma {
+			if value, ok := dst.Get([]byte(key)); !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %q", key)
+			}
+		}
+
+		// 过期时间在导入后保留
+		var again bytes.Buffer
+		dst.Export(&again)
+		if !strings.Contains(again.String(), `"expire_at"`) {
+			t.Fatal("expire_at should survive import")
+		}
+	})
+
+	t.Run("Invalid Input", func(t *testing.T) {
+		dst := newDB(t, "invalid")
+		defer dst.Close()
+		input := `{"key":"YQ==","value":"MQ=="}` + "\n" + `{"key":"", "value":"MQ=="}` + "\n"
+		count, err := dst.Import(strings.NewReader(input), ImportOptions{})
+		if !errors.Is(err, ErrEmptyKey) || count != 0 {
+			t.Fatalf("expected ErrEmptyKey, got %d %v", count, err)
+		}
+		if _, err := dst.Import(strings.NewReader("not json\n"), ImportOptions{}); err == nil {
+			t.Fatal("expected error for malformed input")
+		}
+	})
+}
@@ -3,6 +3,7 @@ package file_manage
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 // FileIO 文件IO
@@ -12,6 +13,8 @@ type FileIO struct {
 	FileID  int64    // 文件ID
 	Offset  int64    // 偏移量
 	// mu      sync.RWMutex // 添加互斥锁保护并发访问
+
+	OnSync func(d time.Duration, err error) // 每次同步后调用，用于统计同步次数和耗时
 }
 
 func (f *FileIO) Seek(offset int64, whence int) (int64, error) {
@@ -23,7 +26,8 @@ func (f *FileIO) Write(data []byte) (int64, error) {
 	// f.mu.Lock()
 	// defer f.mu.Unlock()
 
-	n, err := f.File.Write(data)
+	// 从当前偏移量写入，重新打开文件后文件指针位于文件开头
+	n, err := f.File.WriteAt(data, f.Offset)
 	if err != nil {
 		return 0, fmt.Errorf("write error: %v", err)
 	}
@@ -80,10 +84,25 @@ func (f *FileIO) Size() (int64, error) {
 	}
 	return info.Size(), nil
 }
+func (f *FileIO) Truncate(size int64) error {
+	// f.mu.Lock()
+	// defer f.mu.Unlock()
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+	f.Offset = size
+	return nil
+}
 func (f *FileIO) Sync() error {
 	// f.mu.Lock()
 	// defer f.mu.Unlock()
-	return f.File.Sync()
+	if f.OnSync == nil {
+		return f.File.Sync()
+	}
+	start := time.Now()
+	err := f.File.Sync()
+	f.OnSync(time.Since(start), err)
+	return err
 }
 func (f *FileIO) Close() error {
 	// f.mu.Lock()
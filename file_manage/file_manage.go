@@ -2,8 +2,7 @@ package file_manage
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 )
 
 // FileManager 文件管理器
@@ -14,24 +13,30 @@ type FileManager interface {
 	Close() error
 	GetFileID() int64
 	Size() (int64, error)
+	Truncate(size int64) error
 	Sync() error
 	GetOffset() int64
 	SetOffset(offset int64)
 }
 
-// NewFileManager 创建一个新的文件管理器
+// Options 文件管理器选项
+type Options struct {
+	OnSync func(d time.Duration, err error) // 每次同步后调用，nil表示不统计
+}
+
+// NewFileManager 创建一个新的文件管理器，文件所在目录需由调用方提前创建
 func NewFileManager(filePath string, fileID int64) (FileManager, error) {
-	// 确保父目录存在
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %v", err)
-	}
+	return NewFileManagerWithOptions(filePath, fileID, Options{})
+}
 
+// NewFileManagerWithOptions 使用指定的选项创建文件管理器
+func NewFileManagerWithOptions(filePath string, fileID int64, options Options) (FileManager, error) {
 	// 创建 FileIO 实例
 	fileIO, err := NewFileIO(filePath, fileID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file IO: %v", err)
 	}
+	fileIO.OnSync = options.OnSync
 
 	return fileIO, nil
 }
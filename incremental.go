@@ -0,0 +1,327 @@
+package bitcask
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+const (
+	backupManifestName = "MANIFEST" // 备份描述文件
+	backupDirPrefix    = "backup_"  // 备份链中每次备份的目录前缀
+)
+
+var (
+	ErrNoBackup        = errors.New("no backup found")
+	ErrBackupCorrupted = errors.New("backup is corrupted")
+)
+
+// BackupFileState 备份时数据文件的状态
+type BackupFileState struct {
+	Name      string `json:"name"`       // 相对于数据目录的路径
+	CreatedAt int64  `json:"created_at"` // 文件头中的创建时间，合并复用文件id时用于区分新旧文件
+	Size      int64  `json:"size"`
+}
+
+// BackupPiece 一次备份中保存的一段文件内容
+type BackupPiece struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"` // 在数据文件中的起始位置，0表示整个文件
+	Size   int64  `json:"size"`
+	CRC32  uint32 `json:"crc32"`
+}
+
+// BackupManifest 一次备份的描述，Files为备份时的所有数据文件，Pieces为本次备份保存的内容
+type BackupManifest struct {
+	ID        int               `json:"id"`
+	CreatedAt int64             `json:"created_at"`
+	Files     []BackupFileState `json:"files"`
+	Pieces    []BackupPiece     `json:"pieces"`
+}
+
+// backupSource 备份时打开的数据文件
+type backupSource struct {
+	state BackupFileState
+	src   *os.File
+}
+
+// getBackupDir 获取备份链中第id次备份的目录
+func getBackupDir(chainDir string, id int) string {
+	return filepath.Join(chainDir, fmt.Sprintf("%s%06d", backupDirPrefix, id))
+}
+
+// BackupIncremental 向备份链chainDir追加一次备份，第一次为全量备份，
+// 之后只保存新的wal和blob文件，以及上次备份后已有文件追加的部分。
+// hint文件不备份，恢复后第一次打开时重新生成
+func (b *Bitcask) BackupIncremental(chainDir string) (*BackupManifest, error) {
+	manifests, err := readBackupChain(chainDir)
+	if err != nil {
+		return nil, err
+	}
+	prev := make(map[string]BackupFileState)
+	if len(manifests) > 0 {
+		for _, state := range manifests[len(manifests)-1].Files {
+			prev[state.Name] = state
+		}
+	}
+
+	sources, err := b.openBackupSources()
+	defer func() {
+		for _, s := range sources {
+			s.src.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{
+		ID:        len(manifests),
+		CreatedAt: time.Now().UnixNano(),
+		Files:     make([]BackupFileState, 0, len(sources)),
+		Pieces:    make([]BackupPiece, 0),
+	}
+	backupDir := getBackupDir(chainDir, manifest.ID)
+	// 清理上次没有完成的备份
+	if err := os.RemoveAll(backupDir); err != nil {
+		return nil, fmt.Errorf("failed to clean backup directory: %v", err)
+	}
+	for _, s := range sources {
+		manifest.Files = append(manifest.Files, s.state)
+		var offset int64
+		if p, ok := prev[s.state.Name]; ok && p.CreatedAt == s.state.CreatedAt && p.Size <= s.state.Size {
+			offset = p.Size
+		}
+		if offset == s.state.Size && offset > 0 {
+			continue
+		}
+		piece, err := writeBackupPiece(s.src, filepath.Join(backupDir, s.state.Name), s.state.Name, offset, s.state.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %v", s.state.Name, err)
+		}
+		manifest.Pieces = append(manifest.Pieces, piece)
+	}
+
+	if err := writeBackupManifest(backupDir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// openBackupSources 持有写锁同步并打开所有wal和blob文件，记录此时的大小，
+// 之后文件被追加、合并替换或删除都不影响备份的内容
+func (b *Bitcask) openBackupSources() ([]backupSource, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.syncBlob(); err != nil {
+		return nil, err
+	}
+	if err := b.activeWal.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync active wal: %v", err)
+	}
+
+	// 使用相对于数据目录的路径
+	files := make(map[string]*wal.WAL)
+	for fileId, w := range b.olderWal {
+		files[filepath.Join(getWalDir(""), getWalFileName(fileId))] = w
+	}
+	files[filepath.Join(getWalDir(""), getWalFileName(b.fileId))] = b.activeWal
+	for fileId, blob := range b.blobs {
+		files[filepath.Join(getBlobDir(""), getBlobFileName(fileId))] = blob
+	}
+
+	sources := make([]backupSource, 0, len(files))
+	for name, w := range files {
+		f, err := os.Open(filepath.Join(b.config.DirPath, name))
+		if err != nil {
+			return sources, fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		sources = append(sources, backupSource{
+			state: BackupFileState{Name: name, CreatedAt: w.Header().CreatedAt, Size: w.GetOffset()},
+			src:   f,
+		})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].state.Name < sources[j].state.Name
+	})
+	return sources, nil
+}
+
+// writeBackupPiece 将src中[offset, size)的内容写入dst，返回内容的描述
+func writeBackupPiece(src *os.File, dst, name string, offset, size int64) (BackupPiece, error) {
+	piece := BackupPiece{Name: name, Offset: offset, Size: size - offset}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return piece, err
+	}
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return piece, err
+	}
+	defer out.Close()
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(out, crc), io.NewSectionReader(src, offset, piece.Size)); err != nil {
+		return piece, err
+	}
+	if err := out.Sync(); err != nil {
+		return piece, err
+	}
+	piece.CRC32 = crc.Sum32()
+	return piece, nil
+}
+
+// writeBackupManifest 最后写入描述文件，没有描述文件的备份视为未完成
+func writeBackupManifest(backupDir string, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup manifest: %v", err)
+	}
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	tmpPath := filepath.Join(backupDir, backupManifestName+".tmp")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %v", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(backupDir, backupManifestName)); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %v", err)
+	}
+	return syncDir(backupDir)
+}
+
+// readBackupChain 按顺序读取备份链中所有已完成的备份，遇到未完成的备份时停止
+func readBackupChain(chainDir string) ([]*BackupManifest, error) {
+	entries, err := os.ReadDir(chainDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup chain: %v", err)
+	}
+	ids := make([]int, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), backupDirPrefix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), backupDirPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup directory %s: %v", entry.Name(), err)
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	manifests := make([]*BackupManifest, 0, len(ids))
+	for i, id := range ids {
+		if id != i {
+			return nil, fmt.Errorf("%w: backup %d is missing", ErrBackupCorrupted, i)
+		}
+		data, err := os.ReadFile(filepath.Join(getBackupDir(chainDir, id), backupManifestName))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup manifest: %v", err)
+		}
+		manifest := &BackupManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("%w: invalid manifest in backup %d: %v", ErrBackupCorrupted, id, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// Restore 用备份链chainDir中的全量备份和之后的增量备份恢复到dir，dir不存在或为空时才能恢复。
+// 每段内容写入时校验crc，恢复后校验每个文件的大小
+func Restore(chainDir, dir string) error {
+	manifests, err := readBackupChain(chainDir)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return ErrNoBackup
+	}
+	if err := prepareEmptyDir(dir); err != nil {
+		return err
+	}
+
+	final := make(map[string]BackupFileState)
+	for _, state := range manifests[len(manifests)-1].Files {
+		final[state.Name] = state
+	}
+	for _, manifest := range manifests {
+		for _, piece := range manifest.Pieces {
+			// 之后被合并删除的文件不需要恢复
+			if _, ok := final[piece.Name]; !ok {
+				continue
+			}
+			src := filepath.Join(getBackupDir(chainDir, manifest.ID), piece.Name)
+			if err := restorePiece(src, filepath.Join(dir, piece.Name), piece); err != nil {
+				return fmt.Errorf("failed to restore %s from backup %d: %w", piece.Name, manifest.ID, err)
+			}
+		}
+	}
+
+	for name, state := range final {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("%w: %s is missing", ErrBackupCorrupted, name)
+		}
+		if info.Size() != state.Size {
+			return fmt.Errorf("%w: %s has size %d, want %d", ErrBackupCorrupted, name, info.Size(), state.Size)
+		}
+	}
+	for _, d := range []string{getWalDir(dir), getBlobDir(dir)} {
+		if err := syncDir(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restorePiece 写入并校验一段内容，offset为0时创建新文件，否则追加到已恢复的文件末尾
+func restorePiece(src, dst string, piece BackupPiece) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupCorrupted, err)
+	}
+	defer in.Close()
+
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if piece.Offset > 0 {
+		flag = os.O_RDWR
+	}
+	out, err := os.OpenFile(dst, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupCorrupted, err)
+	}
+	defer out.Close()
+	info, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != piece.Offset {
+		return fmt.Errorf("%w: file has size %d, piece starts at %d", ErrBackupCorrupted, info.Size(), piece.Offset)
+	}
+
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(io.NewOffsetWriter(out, piece.Offset), io.TeeReader(in, crc))
+	if err != nil {
+		return err
+	}
+	if n != piece.Size || crc.Sum32() != piece.CRC32 {
+		return fmt.Errorf("%w: checksum mismatch", ErrBackupCorrupted)
+	}
+	return out.Sync()
+}
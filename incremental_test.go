@@ -0,0 +1,173 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskIncrementalBackup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-incremental-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:       filepath.Join(dir, "db"),
+		MaxFileSize:   1024,
+		IndexType:     "btree",
+		BlobThreshold: 100,
+		BlobFileSize:  1024,
+		BlobGCRatio:   0.1,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	chainDir := filepath.Join(dir, "chain")
+	ma := make(map[string][]byte)
+	write := func(from, to int, tag string) {
+		for i := from; i < to; i++ {
+			key := utils.GenerateKey(i)
+			value := []byte(fmt.Sprintf("%s-%d", tag, i))
+			if i%10 == 0 {
+				value = bytes.Repeat(value, 20)
+			}
+			db.Put(key, value)
+			ma[string(key)] = value
+		}
+	}
+	restoreAndCheck := func(t *testing.T, name string) {
+		restoreDir := filepath.Join(dir, name)
+		if err := Restore(chainDir, restoreDir); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		restored, err := NewBitcask(&Config{DirPath: restoreDir, MaxFileSize: 1024, IndexType: "btree"})
+		if err != nil {
+			t.Fatalf("failed to open restored db: %v", err)
+		}
+		defer restored.Close()
+		if len(restored.Recovery()) != 0 {
+			t.Fatalf("restored db should not need recovery: %+v", restored.Recovery())
+		}
+		count := 0
+		it := restored.Scan(nil, nil, ScanOptions{})
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			count++
+		}
+		if count != len(ma) {
+			t.Fatalf("restored db has %d keys, want %d", count, len(ma))
+		}
+		for key, want := range ma {
+			if value, ok := restored.Get([]byte(key)); !ok || !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+
+	var base *BackupManifest
+	t.Run("Base", func(t *testing.T) {
+		write(0, 100, "v1")
+		base, err = db.BackupIncremental(chainDir)
+		if err != nil {
+			t.Fatalf("BackupIncremental failed: %v", err)
+		}
+		if base.ID != 0 || len(base.Pieces) != len(base.Files) {
+			t.Fatalf("base backup should contain every file: %d pieces, %d files", len(base.Pieces), len(base.Files))
+		}
+		restoreAndCheck(t, "restore0")
+	})
+
+	t.Run("Increment", func(t *testing.T) {
+		write(100, 150, "v1")
+		manifest, err := db.BackupIncremental(chainDir)
+		if err != nil {
+			t.Fatalf("BackupIncremental failed: %v", err)
+		}
+		// 已封存且没有变化的文件不再备份
+		shipped := make(map[string]BackupPiece)
+		for _, piece := range manifest.Pieces {
+			shipped[piece.Name] = piece
+		}
+		for _, state := range base.Files {
+			piece, ok := shipped[state.Name]
+			if ok && piece.Offset != state.Size {
+				t.Fatalf("%s should only ship the appended part, got offset %d size %d", state.Name, piece.Offset, state.Size)
+			}
+		}
+		if len(manifest.Pieces) >= len(manifest.Files) {
+			t.Fatalf("increment should ship fewer files: %d pieces, %d files", len(manifest.Pieces), len(manifest.Files))
+		}
+		restoreAndCheck(t, "restore1")
+	})
+
+	t.Run("After Merge", func(t *testing.T) {
+		// 合并复用文件id重写文件，增量备份需要重新备份整个文件
+		for i := 0; i < 50; i++ {
+			db.Del(utils.GenerateKey(i))
+			delete(ma, string(utils.GenerateKey(i)))
+		}
+		write(50, 80, "v2")
+		if err := db.Merge(); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if _, err := db.BlobGC(); err != nil {
+			t.Fatalf("BlobGC failed: %v", err)
+		}
+		write(150, 160, "v2")
+		if _, err := db.BackupIncremental(chainDir); err != nil {
+			t.Fatalf("BackupIncremental failed: %v", err)
+		}
+		restoreAndCheck(t, "restore2")
+	})
+
+	t.Run("Incomplete Backup", func(t *testing.T) {
+		// 没有描述文件的备份被忽略，下次备份时覆盖
+		incomplete := getBackupDir(chainDir, 3)
+		os.MkdirAll(incomplete, 0755)
+		os.WriteFile(filepath.Join(incomplete, "garbage"), []byte("garbage"), 0644)
+		restoreAndCheck(t, "restore3")
+		write(160, 170, "v3")
+		manifest, err := db.BackupIncremental(chainDir)
+		if err != nil || manifest.ID != 3 {
+			t.Fatalf("BackupIncremental mismatch: %v %v", manifest, err)
+		}
+		restoreAndCheck(t, "restore4")
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		manifests, err := readBackupChain(chainDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := manifests[len(manifests)-1]
+		piece := last.Pieces[0]
+		path := filepath.Join(getBackupDir(chainDir, last.ID), piece.Name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		os.WriteFile(path, data, 0644)
+		if err := Restore(chainDir, filepath.Join(dir, "restore5")); !errors.Is(err, ErrBackupCorrupted) {
+			t.Fatalf("expected ErrBackupCorrupted, got %v", err)
+		}
+	})
+
+	t.Run("No Backup", func(t *testing.T) {
+		if err := Restore(filepath.Join(dir, "missing"), filepath.Join(dir, "restore6")); !errors.Is(err, ErrNoBackup) {
+			t.Fatalf("expected ErrNoBackup, got %v", err)
+		}
+	})
+}
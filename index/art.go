@@ -0,0 +1,563 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// ARTIndex 自适应基数树索引，共享前缀的key只保存一份前缀，内存占用更小
+type ARTIndex struct {
+	mu   sync.RWMutex
+	root *artNode
+	size int
+}
+
+// artLeaf 叶子，保存完整的key和位置信息
+type artLeaf struct {
+	key []byte
+	pos *record.Pos
+}
+
+type artKind uint8
+
+// 节点类型，按子节点数量自动扩容和收缩
+const (
+	artNode4 artKind = iota
+	artNode16
+	artNode48
+	artNode256
+)
+
+// 每种节点的容量
+var artCapacity = [...]int{4, 16, 48, 256}
+
+// artNode 树节点，prefix为压缩的路径，key在该节点结束时leaf不为nil
+type artNode struct {
+	kind     artKind
+	prefix   []byte
+	leaf     *artLeaf
+	num      int        // 子节点数量
+	keys     []byte     // node4/node16: 有序的子节点字节
+	index    []uint8    // node48: 字节到子节点下标+1的映射
+	children []*artNode // 子节点
+}
+
+// NewARTIndex 创建自适应基数树索引
+func NewARTIndex() *ARTIndex {
+	return &ARTIndex{}
+}
+
+func newARTNode(kind artKind, prefix []byte) *artNode {
+	n := &artNode{
+		kind:     kind,
+		prefix:   prefix,
+		children: make([]*artNode, artCapacity[kind]),
+	}
+	switch kind {
+	case artNode4, artNode16:
+		n.keys = make([]byte, artCapacity[kind])
+	case artNode48:
+		n.index = make([]uint8, 256)
+	}
+	return n
+}
+
+// newARTLeafNode 创建只包含一个key的节点
+func newARTLeafNode(prefix []byte, leaf *artLeaf) *artNode {
+	n := newARTNode(artNode4, append([]byte(nil), prefix...))
+	n.leaf = leaf
+	return n
+}
+
+// findChild 查找字节c对应的子节点槽位
+func (n *artNode) findChild(c byte) **artNode {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.num, func(i int) bool { return n.keys[i] >= c })
+		if i < n.num && n.keys[i] == c {
+			return &n.children[i]
+		}
+	case artNode48:
+		if slot := n.index[c]; slot > 0 {
+			return &n.children[slot-1]
+		}
+	case artNode256:
+		if n.children[c] != nil {
+			return &n.children[c]
+		}
+	}
+	return nil
+}
+
+// addChild 添加子节点，调用方需保证节点未满
+func (n *artNode) addChild(c byte, child *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.num, func(i int) bool { return n.keys[i] >= c })
+		copy(n.keys[i+1:n.num+1], n.keys[i:n.num])
+		copy(n.children[i+1:n.num+1], n.children[i:n.num])
+		n.keys[i] = c
+		n.children[i] = child
+	case artNode48:
+		slot := 0
+		for n.children[slot] != nil {
+			slot++
+		}
+		n.children[slot] = child
+		n.index[c] = uint8(slot + 1)
+	case artNode256:
+		n.children[c] = child
+	}
+	n.num++
+}
+
+// removeChild 删除子节点
+func (n *artNode) removeChild(c byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.num, func(i int) bool { return n.keys[i] >= c })
+		if i >= n.num || n.keys[i] != c {
+			return
+		}
+		copy(n.keys[i:], n.keys[i+1:n.num])
+		copy(n.children[i:], n.children[i+1:n.num])
+		n.children[n.num-1] = nil
+	case artNode48:
+		slot := n.index[c]
+		if slot == 0 {
+			return
+		}
+		n.children[slot-1] = nil
+		n.index[c] = 0
+	case artNode256:
+		if n.children[c] == nil {
+			return
+		}
+		n.children[c] = nil
+	}
+	n.num--
+}
+
+// full 节点是否已满
+func (n *artNode) full() bool {
+	return n.num == artCapacity[n.kind]
+}
+
+// eachChild 按字节顺序遍历子节点，fn返回false时停止
+func (n *artNode) eachChild(fn func(c byte, child *artNode) bool) bool {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := 0; i < n.num; i++ {
+			if !fn(n.keys[i], n.children[i]) {
+				return false
+			}
+		}
+	case artNode48:
+		for c := 0; c < 256; c++ {
+			if slot := n.index[c]; slot > 0 {
+				if !fn(byte(c), n.children[slot-1]) {
+					return false
+				}
+			}
+		}
+	case artNode256:
+		for c := 0; c < 256; c++ {
+			if child := n.children[c]; child != nil {
+				if !fn(byte(c), child) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// eachChildReverse 按字节逆序遍历子节点，fn返回false时停止
+func (n *artNode) eachChildReverse(fn func(c byte, child *artNode) bool) bool {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := n.num - 1; i >= 0; i-- {
+			if !fn(n.keys[i], n.children[i]) {
+				return false
+			}
+		}
+	case artNode48:
+		for c := 255; c >= 0; c-- {
+			if slot := n.index[c]; slot > 0 {
+				if !fn(byte(c), n.children[slot-1]) {
+					return false
+				}
+			}
+		}
+	case artNode256:
+		for c := 255; c >= 0; c-- {
+			if child := n.children[c]; child != nil {
+				if !fn(byte(c), child) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// resize 将节点转换为指定类型
+func (n *artNode) resize(kind artKind) *artNode {
+	resized := newARTNode(kind, n.prefix)
+	resized.leaf = n.leaf
+	n.eachChild(func(c byte, child *artNode) bool {
+		resized.addChild(c, child)
+		return true
+	})
+	return resized
+}
+
+// Get 获取键对应的位置信息
+func (idx *ARTIndex) Get(key []byte) (*record.Pos, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := idx.root
+	depth := 0
+	for n != nil {
+		if !bytes.HasPrefix(key[depth:], n.prefix) {
+			return nil, ErrKeyNotFound
+		}
+		depth += len(n.prefix)
+		if depth == len(key) {
+			if n.leaf == nil {
+				return nil, ErrKeyNotFound
+			}
+			return n.leaf.pos, nil
+		}
+		child := n.findChild(key[depth])
+		if child == nil {
+			return nil, ErrKeyNotFound
+		}
+		n = *child
+		depth++
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Put 将键值对的位置信息存入索引
+func (idx *ARTIndex) Put(key []byte, pos *record.Pos) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if pos == nil {
+		return ErrNilPos
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	leaf := &artLeaf{key: key, pos: pos}
+	if !idx.insert(&idx.root, key, 0, leaf) {
+		idx.size++
+	}
+	return nil
+}
+
+// insert 插入叶子，返回是否替换了已有的key
+func (idx *ARTIndex) insert(ref **artNode, key []byte, depth int, leaf *artLeaf) bool {
+	n := *ref
+	if n == nil {
+		*ref = newARTLeafNode(key[depth:], leaf)
+		return false
+	}
+
+	// 前缀不匹配时在分叉处拆分节点
+	p := commonPrefixLength(n.prefix, key[depth:])
+	if p < len(n.prefix) {
+		parent := newARTNode(artNode4, n.prefix[:p:p])
+		c := n.prefix[p]
+		n.prefix = n.prefix[p+1:]
+		parent.addChild(c, n)
+		if depth+p == len(key) {
+			parent.leaf = leaf
+		} else {
+			parent.addChild(key[depth+p], newARTLeafNode(key[depth+p+1:], leaf))
+		}
+		*ref = parent
+		return false
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		replaced := n.leaf != nil
+		n.leaf = leaf
+		return replaced
+	}
+	if child := n.findChild(key[depth]); child != nil {
+		return idx.insert(child, key, depth+1, leaf)
+	}
+	if n.full() {
+		n = n.resize(n.kind + 1)
+		*ref = n
+	}
+	n.addChild(key[depth], newARTLeafNode(key[depth+1:], leaf))
+	return false
+}
+
+// Delete 从索引中删除键
+func (idx *ARTIndex) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.delete(&idx.root, key, 0) {
+		return ErrKeyNotFound
+	}
+	idx.size--
+	return nil
+}
+
+// delete 删除key，返回key是否存在
+func (idx *ARTIndex) delete(ref **artNode, key []byte, depth int) bool {
+	n := *ref
+	if n == nil || !bytes.HasPrefix(key[depth:], n.prefix) {
+		return false
+	}
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.leaf == nil {
+			return false
+		}
+		n.leaf = nil
+		compactARTNode(ref)
+		return true
+	}
+	c := key[depth]
+	child := n.findChild(c)
+	if child == nil || !idx.delete(child, key, depth+1) {
+		return false
+	}
+	if *child == nil {
+		n.removeChild(c)
+	}
+	compactARTNode(ref)
+	return true
+}
+
+// compactARTNode 删除后收缩节点：没有key的空节点被删除，
+// 只有一个子节点的节点与子节点合并，子节点较少时换成更小的节点类型
+func compactARTNode(ref **artNode) {
+	n := *ref
+	if n.leaf == nil && n.num == 0 {
+		*ref = nil
+		return
+	}
+	if n.leaf == nil && n.num == 1 {
+		n.eachChild(func(c byte, child *artNode) bool {
+			prefix := make([]byte, 0, len(n.prefix)+1+len(child.prefix))
+			prefix = append(prefix, n.prefix...)
+			prefix = append(prefix, c)
+			child.prefix = append(prefix, child.prefix...)
+			*ref = child
+			return false
+		})
+		return
+	}
+	if n.kind > artNode4 && n.num <= artCapacity[n.kind-1]/2 {
+		*ref = n.resize(n.kind - 1)
+	}
+}
+
+// commonPrefixLength 返回两个字节切片公共前缀的长度
+func commonPrefixLength(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Len 返回索引中的键值对数量
+func (idx *ARTIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.size
+}
+
+// Iterator 返回遍历所有key的迭代器
+func (idx *ARTIndex) Iterator() IndexIter {
+	return idx.NewIterator(IterOptions{})
+}
+
+// NewIterator 返回迭代器，迭代器每次移动时加读锁在树上查找后继或前驱，
+// 能看到创建之后的写入，每次移动和Seek的代价与key长度成正比
+func (idx *ARTIndex) NewIterator(opts IterOptions) IndexIter {
+	return newRangeIterator(artSource{idx: idx}, opts)
+}
+
+// artSource 在基数树上查找
+type artSource struct {
+	idx *ARTIndex
+}
+
+func (s artSource) ceiling(key []byte, strict bool) *indexItem {
+	s.idx.mu.RLock()
+	defer s.idx.mu.RUnlock()
+	var leaf *artLeaf
+	if key == nil {
+		leaf = artMinimum(s.idx.root)
+	} else {
+		leaf = artCeiling(s.idx.root, key, 0, strict)
+	}
+	return leaf.item()
+}
+
+func (s artSource) floor(key []byte, strict bool) *indexItem {
+	s.idx.mu.RLock()
+	defer s.idx.mu.RUnlock()
+	var leaf *artLeaf
+	if key == nil {
+		leaf = artMaximum(s.idx.root)
+	} else {
+		leaf = artFloor(s.idx.root, key, 0, strict)
+	}
+	return leaf.item()
+}
+
+// item 将叶子转换为迭代器使用的项
+func (l *artLeaf) item() *indexItem {
+	if l == nil {
+		return nil
+	}
+	return &indexItem{key: l.key, pos: l.pos}
+}
+
+// artMinimum 返回子树中最小的叶子，节点上的key比子节点中的key小
+func artMinimum(n *artNode) *artLeaf {
+	for n != nil {
+		if n.leaf != nil {
+			return n.leaf
+		}
+		var first *artNode
+		n.eachChild(func(c byte, child *artNode) bool {
+			first = child
+			return false
+		})
+		n = first
+	}
+	return nil
+}
+
+// artMaximum 返回子树中最大的叶子
+func artMaximum(n *artNode) *artLeaf {
+	for n != nil {
+		var last *artNode
+		n.eachChildReverse(func(c byte, child *artNode) bool {
+			last = child
+			return false
+		})
+		if last == nil {
+			return n.leaf
+		}
+		n = last
+	}
+	return nil
+}
+
+// comparePrefix 比较节点前缀与key的剩余部分，返回值小于0表示子树中所有key都比key小，
+// 大于0表示都比key大，等于0表示前缀匹配需要继续向下查找
+func comparePrefix(prefix, rest []byte) int {
+	p := commonPrefixLength(prefix, rest)
+	if p == len(prefix) {
+		return 0
+	}
+	if p == len(rest) {
+		// key是前缀的前缀，子树中的key都更长
+		return 1
+	}
+	return int(prefix[p]) - int(rest[p])
+}
+
+// artCeiling 返回子树中第一个不小于key（strict时大于key）的叶子
+func artCeiling(n *artNode, key []byte, depth int, strict bool) *artLeaf {
+	if n == nil {
+		return nil
+	}
+	switch c := comparePrefix(n.prefix, key[depth:]); {
+	case c < 0:
+		return nil
+	case c > 0:
+		return artMinimum(n)
+	}
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.leaf != nil && !strict {
+			return n.leaf
+		}
+		// 子节点中的key都比key长
+		var found *artLeaf
+		n.eachChild(func(c byte, child *artNode) bool {
+			found = artMinimum(child)
+			return found == nil
+		})
+		return found
+	}
+
+	var found *artLeaf
+	b := key[depth]
+	n.eachChild(func(c byte, child *artNode) bool {
+		switch {
+		case c == b:
+			found = artCeiling(child, key, depth+1, strict)
+		case c > b:
+			found = artMinimum(child)
+		}
+		return found == nil
+	})
+	return found
+}
+
+// artFloor 返回子树中最后一个不大于key（strict时小于key）的叶子
+func artFloor(n *artNode, key []byte, depth int, strict bool) *artLeaf {
+	if n == nil {
+		return nil
+	}
+	switch c := comparePrefix(n.prefix, key[depth:]); {
+	case c < 0:
+		return artMaximum(n)
+	case c > 0:
+		return nil
+	}
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if strict {
+			return nil
+		}
+		return n.leaf
+	}
+
+	var found *artLeaf
+	b := key[depth]
+	n.eachChildReverse(func(c byte, child *artNode) bool {
+		switch {
+		case c == b:
+			found = artFloor(child, key, depth+1, strict)
+		case c < b:
+			found = artMaximum(child)
+		}
+		return found == nil
+	})
+	if found == nil {
+		// 节点上的key是key的前缀，比key小
+		return n.leaf
+	}
+	return found
+}
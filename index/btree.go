@@ -2,7 +2,6 @@ package index
 
 import (
 	"bytes"
-	"errors"
 	"sync"
 
 	"github.com/google/btree"
@@ -36,7 +35,7 @@ func NewBTreeIndex(degree int) *BTreeIndex {
 // Get 获取键对应的位置信息
 func (idx *BTreeIndex) Get(key []byte) (*record.Pos, error) {
 	if len(key) == 0 {
-		return nil, errors.New("key is empty")
+		return nil, ErrEmptyKey
 	}
 
 	idx.mu.RLock()
@@ -44,7 +43,7 @@ func (idx *BTreeIndex) Get(key []byte) (*record.Pos, error) {
 
 	item := idx.items.Get(&indexItem{key: key})
 	if item == nil {
-		return nil, errors.New("key not found")
+		return nil, ErrKeyNotFound
 	}
 	return item.(*indexItem).pos, nil
 }
@@ -52,10 +51,10 @@ func (idx *BTreeIndex) Get(key []byte) (*record.Pos, error) {
 // Put 将键值对的位置信息存入索引
 func (idx *BTreeIndex) Put(key []byte, pos *record.Pos) error {
 	if len(key) == 0 {
-		return errors.New("key is empty")
+		return ErrEmptyKey
 	}
 	if pos == nil {
-		return errors.New("pos is nil")
+		return ErrNilPos
 	}
 
 	idx.mu.Lock()
@@ -71,7 +70,7 @@ func (idx *BTreeIndex) Put(key []byte, pos *record.Pos) error {
 // Delete 从索引中删除键
 func (idx *BTreeIndex) Delete(key []byte) error {
 	if len(key) == 0 {
-		return errors.New("key is empty")
+		return ErrEmptyKey
 	}
 
 	idx.mu.Lock()
@@ -79,7 +78,7 @@ func (idx *BTreeIndex) Delete(key []byte) error {
 
 	item := idx.items.Delete(&indexItem{key: key})
 	if item == nil {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
 	return nil
 }
@@ -91,90 +90,69 @@ func (idx *BTreeIndex) Len() int {
 	return idx.items.Len()
 }
 
-// Iterator 返回一个迭代器
-func (idx *BTreeIndex) Iterator() IndexIter {
-	return NewBTreeIterator(idx)
+// Clone 返回写时复制的副本，代价为O(1)，之后两者的写入互不影响
+func (idx *BTreeIndex) Clone() *BTreeIndex {
+	// Clone不能与写入并发
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return &BTreeIndex{items: idx.items.Clone()}
 }
 
-// BTreeIterator 实现 IndexIter 接口
-type BTreeIterator struct {
-	idx       *BTreeIndex
-	currItem  *indexItem
-	items     []*indexItem
-	currIndex int
+// Iterator 返回遍历所有key的迭代器
+func (idx *BTreeIndex) Iterator() IndexIter {
+	return idx.NewIterator(IterOptions{})
 }
 
-func NewBTreeIterator(idx *BTreeIndex) *BTreeIterator {
-	iter := &BTreeIterator{
-		idx:       idx,
-		items:     make([]*indexItem, 0),
-		currIndex: -1,
-	}
-
-	// 收集所有项
-	idx.mu.RLock()
-	idx.items.Ascend(func(i btree.Item) bool {
-		iter.items = append(iter.items, i.(*indexItem))
-		return true
-	})
-	idx.mu.RUnlock()
-
-	if len(iter.items) > 0 {
-		iter.currIndex = 0
-		iter.currItem = iter.items[0]
-	}
-
-	return iter
+// NewIterator 返回迭代器，迭代器遍历创建时的写时复制克隆，
+// 创建的代价为O(1)，每次移动和Seek的代价为O(log n)，不持有锁也不复制数据
+func (idx *BTreeIndex) NewIterator(opts IterOptions) IndexIter {
+	// Clone不能与写入并发
+	idx.mu.Lock()
+	tree := idx.items.Clone()
+	idx.mu.Unlock()
+	return newRangeIterator(btreeSource{tree: tree}, opts)
 }
 
-func (iter *BTreeIterator) Prev() {
-	if iter.currIndex > 0 {
-		iter.currIndex--
-		iter.currItem = iter.items[iter.currIndex]
-	} else {
-		iter.currItem = nil
-	}
+// btreeSource 在btree克隆上查找
+type btreeSource struct {
+	tree *btree.BTree
 }
 
-func (iter *BTreeIterator) Next() {
-	if iter.currIndex < len(iter.items)-1 {
-		iter.currIndex++
-		iter.currItem = iter.items[iter.currIndex]
-	} else {
-		iter.currItem = nil
+func (s btreeSource) ceiling(key []byte, strict bool) *indexItem {
+	if key == nil {
+		return toIndexItem(s.tree.Min())
 	}
-}
-
-func (iter *BTreeIterator) Seek(key []byte) {
-	for i, item := range iter.items {
-		if bytes.Compare(item.key, key) >= 0 {
-			iter.currIndex = i
-			iter.currItem = item
-			return
+	var found *indexItem
+	s.tree.AscendGreaterOrEqual(&indexItem{key: key}, func(i btree.Item) bool {
+		item := i.(*indexItem)
+		if strict && bytes.Equal(item.key, key) {
+			return true
 		}
-	}
-	iter.currItem = nil
-}
-
-func (iter *BTreeIterator) Valid() bool {
-	return iter.currItem != nil
+		found = item
+		return false
+	})
+	return found
 }
 
-func (iter *BTreeIterator) Key() []byte {
-	if iter.currItem == nil {
-		return nil
+func (s btreeSource) floor(key []byte, strict bool) *indexItem {
+	if key == nil {
+		return toIndexItem(s.tree.Max())
 	}
-	return iter.currItem.key
+	var found *indexItem
+	s.tree.DescendLessOrEqual(&indexItem{key: key}, func(i btree.Item) bool {
+		item := i.(*indexItem)
+		if strict && bytes.Equal(item.key, key) {
+			return true
+		}
+		found = item
+		return false
+	})
+	return found
 }
 
-func (iter *BTreeIterator) Value() *record.Pos {
-	if iter.currItem == nil {
+func toIndexItem(i btree.Item) *indexItem {
+	if i == nil {
 		return nil
 	}
-	return iter.currItem.pos
-}
-
-func (iter *BTreeIterator) Close() {
-	iter.currItem = nil
-	iter.items = nil
+	return i.(*indexItem)
 }
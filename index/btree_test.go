@@ -10,7 +10,10 @@ import (
 
 func TestBTree(t *testing.T) {
 	// 创建索引实例
-	idx := NewIndex("btree")
+	idx, err := NewIndex("btree")
+	if err != nil {
+		t.Fatalf("NewIndex failed: %v", err)
+	}
 
 	t.Run("Basic Operations", func(t *testing.T) {
 		// 测试Put和Get
@@ -77,7 +80,7 @@ func TestBTree(t *testing.T) {
 
 	t.Run("Iterator", func(t *testing.T) {
 		// 清空之前的数据
-		idx = NewIndex("btree")
+		idx, _ = NewIndex("btree")
 
 		// 插入有序的键值对
 		items := []struct {
@@ -171,7 +174,7 @@ func TestBTree(t *testing.T) {
 
 	t.Run("Concurrent Access", func(t *testing.T) {
 		// 创建新的索引实例
-		idx := NewIndex("btree")
+		idx, _ := NewIndex("btree")
 		done := make(chan bool)
 
 		// 并发写入
@@ -206,4 +209,32 @@ func TestBTree(t *testing.T) {
 				idx.Len(), 100)
 		}
 	})
+
+	t.Run("Iterator Snapshot", func(t *testing.T) {
+		// 迭代器遍历创建时的克隆，之后的写入和删除不可见
+		idx := NewBTreeIndex(12)
+		for i := 0; i < 100; i++ {
+			idx.Put([]byte(fmt.Sprintf("key%03d", i)), &record.Pos{Offset: int64(i)})
+		}
+		iter := idx.NewIterator(IterOptions{})
+		for i := 0; i < 100; i += 2 {
+			idx.Delete([]byte(fmt.Sprintf("key%03d", i)))
+		}
+		idx.Put([]byte("key000a"), &record.Pos{})
+		idx.Put([]byte("key001"), &record.Pos{Offset: 1000})
+
+		count := 0
+		for ; iter.Valid(); iter.Next() {
+			if want := fmt.Sprintf("key%03d", count); string(iter.Key()) != want || iter.Value().Offset != int64(count) {
+				t.Fatalf("snapshot mismatch: got %s %v, want %s", iter.Key(), iter.Value(), want)
+			}
+			count++
+		}
+		if count != 100 {
+			t.Fatalf("snapshot should have 100 keys, got %d", count)
+		}
+		if pos, _ := idx.Get([]byte("key001")); pos.Offset != 1000 {
+			t.Fatalf("write after clone lost: %v", pos)
+		}
+	})
 }
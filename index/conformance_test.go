@@ -0,0 +1,308 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// indexTypes 所有需要通过一致性测试的索引类型
+var indexTypes = []string{"btree", "art", "skiplist", "hash", "disk"}
+
+func TestIndexConformance(t *testing.T) {
+	for _, typ := range indexTypes {
+		t.Run(typ, func(t *testing.T) {
+			testIndexConformance(t, func() Index {
+				idx, err := NewIndex(typ)
+				if err != nil {
+					t.Fatalf("NewIndex failed: %v", err)
+				}
+				if closer, ok := idx.(io.Closer); ok {
+					t.Cleanup(func() { closer.Close() })
+				}
+				return idx
+			})
+		})
+	}
+
+	t.Run("Unknown Type", func(t *testing.T) {
+		if _, err := NewIndex("unknown"); !errors.Is(err, ErrUnknownIndexType) {
+			t.Fatalf("expected ErrUnknownIndexType, got %v", err)
+		}
+	})
+}
+
+// testIndexConformance 所有索引实现都必须满足的行为
+func testIndexConformance(t *testing.T, newIndex func() Index) {
+	t.Run("Basic Operations", func(t *testing.T) {
+		idx := newIndex()
+		pos := &record.Pos{FileID: 1, Offset: 100, Size: 10}
+		if err := idx.Put([]byte("key"), pos); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		// 磁盘索引每次返回新的Pos，因此比较值而不是指针
+		if got, err := idx.Get([]byte("key")); err != nil || *got != *pos {
+			t.Fatalf("Get mismatch: %v %v", got, err)
+		}
+
+		// 覆盖写入不增加数量
+		pos2 := &record.Pos{FileID: 2, Offset: 200, Size: 10}
+		idx.Put([]byte("key"), pos2)
+		if got, _ := idx.Get([]byte("key")); *got != *pos2 || idx.Len() != 1 {
+			t.Fatalf("overwrite mismatch: %v len=%d", got, idx.Len())
+		}
+
+		if err := idx.Delete([]byte("key")); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+		if _, err := idx.Get([]byte("key")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+		if err := idx.Delete([]byte("key")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+		if idx.Len() != 0 {
+			t.Fatalf("Len mismatch: %d", idx.Len())
+		}
+	})
+
+	t.Run("Invalid Arguments", func(t *testing.T) {
+		idx := newIndex()
+		if err := idx.Put(nil, &record.Pos{}); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("expected ErrEmptyKey, got %v", err)
+		}
+		if err := idx.Put([]byte("key"), nil); !errors.Is(err, ErrNilPos) {
+			t.Errorf("expected ErrNilPos, got %v", err)
+		}
+		if _, err := idx.Get(nil); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("expected ErrEmptyKey, got %v", err)
+		}
+		if err := idx.Delete(nil); !errors.Is(err, ErrEmptyKey) {
+			t.Errorf("expected ErrEmptyKey, got %v", err)
+		}
+	})
+
+	t.Run("Shared Prefixes", func(t *testing.T) {
+		idx := newIndex()
+		keys := []string{"a", "ab", "abc", "abd", "b", "abcdef", "abce"}
+		for i, key := range keys {
+			idx.Put([]byte(key), &record.Pos{Offset: int64(i)})
+		}
+		for i, key := range keys {
+			if got, err := idx.Get([]byte(key)); err != nil || got.Offset != int64(i) {
+				t.Fatalf("Get %s mismatch: %v %v", key, got, err)
+			}
+		}
+		if _, err := idx.Get([]byte("abcd")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound for abcd, got %v", err)
+		}
+
+		// 删除中间节点上的key不影响子节点
+		idx.Delete([]byte("abc"))
+		idx.Delete([]byte("a"))
+		for _, key := range []string{"ab", "abd", "abcdef", "abce"} {
+			if _, err := idx.Get([]byte(key)); err != nil {
+				t.Fatalf("Get %s failed after delete: %v", key, err)
+			}
+		}
+		if _, err := idx.Get([]byte("abc")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound for abc, got %v", err)
+		}
+	})
+
+	t.Run("Iterator", func(t *testing.T) {
+		idx := newIndex()
+		keys := []string{"b", "a", "abc", "ab", "c", "ba"}
+		for _, key := range keys {
+			idx.Put([]byte(key), &record.Pos{})
+		}
+		sort.Strings(keys)
+
+		iter := idx.Iterator()
+		got := make([]string, 0)
+		for ; iter.Valid(); iter.Next() {
+			got = append(got, string(iter.Key()))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(keys) {
+			t.Fatalf("iteration order mismatch: got %v, want %v", got, keys)
+		}
+
+		iter = idx.Iterator()
+		iter.Seek([]byte("abd"))
+		if !iter.Valid() || string(iter.Key()) != "b" {
+			t.Fatalf("Seek mismatch: %s", iter.Key())
+		}
+		iter.Prev()
+		if !iter.Valid() || string(iter.Key()) != "abc" {
+			t.Fatalf("Prev mismatch: %s", iter.Key())
+		}
+		iter.Seek([]byte("d"))
+		if iter.Valid() {
+			t.Fatal("Seek past the end should be invalid")
+		}
+		iter.Close()
+	})
+
+	t.Run("Bounded Iterator", func(t *testing.T) {
+		idx := newIndex()
+		for _, key := range []string{"a", "ab", "abc", "b", "ba", "c", "d"} {
+			idx.Put([]byte(key), &record.Pos{})
+		}
+		collect := func(iter IndexIter) string {
+			got := make([]string, 0)
+			for ; iter.Valid(); iter.Next() {
+				got = append(got, string(iter.Key()))
+			}
+			iter.Close()
+			return fmt.Sprint(got)
+		}
+
+		tests := []struct {
+			opts IterOptions
+			want string
+		}{
+			{IterOptions{}, "[a ab abc b ba c d]"},
+			{IterOptions{Reverse: true}, "[d c ba b abc ab a]"},
+			{IterOptions{Lower: []byte("ab"), Upper: []byte("c")}, "[ab abc b ba]"},
+			{IterOptions{Lower: []byte("ab"), Upper: []byte("c"), Reverse: true}, "[ba b abc ab]"},
+			{IterOptions{Lower: []byte("aa"), Upper: []byte("bb")}, "[ab abc b ba]"},
+			{IterOptions{Lower: []byte("bb"), Reverse: true}, "[d c]"},
+			{IterOptions{Upper: []byte("a")}, "[]"},
+			{IterOptions{Lower: []byte("e"), Reverse: true}, "[]"},
+		}
+		for _, tt := range tests {
+			if got := collect(idx.NewIterator(tt.opts)); got != tt.want {
+				t.Errorf("%+v: got %s, want %s", tt.opts, got, tt.want)
+			}
+		}
+
+		// 逆序时Seek定位到不大于key的最后一项，Prev向更大的key移动
+		iter := idx.NewIterator(IterOptions{Upper: []byte("c"), Reverse: true})
+		iter.Seek([]byte("bb"))
+		if !iter.Valid() || string(iter.Key()) != "ba" {
+			t.Fatalf("reverse Seek mismatch: %s", iter.Key())
+		}
+		iter.Next()
+		if !iter.Valid() || string(iter.Key()) != "b" {
+			t.Fatalf("reverse Next mismatch: %s", iter.Key())
+		}
+		iter.Prev()
+		iter.Prev()
+		if iter.Valid() {
+			t.Fatalf("Prev past the upper bound should be invalid, got %s", iter.Key())
+		}
+		iter.Seek([]byte("z"))
+		if !iter.Valid() || string(iter.Key()) != "ba" {
+			t.Fatalf("reverse Seek past upper bound mismatch: %s", iter.Key())
+		}
+
+		// 正序时Seek不会越过下界
+		iter = idx.NewIterator(IterOptions{Lower: []byte("b")})
+		iter.Seek([]byte("a"))
+		if !iter.Valid() || string(iter.Key()) != "b" {
+			t.Fatalf("Seek before lower bound mismatch: %s", iter.Key())
+		}
+		iter.Prev()
+		if iter.Valid() {
+			t.Fatalf("Prev past the lower bound should be invalid, got %s", iter.Key())
+		}
+	})
+
+	t.Run("Random Operations", func(t *testing.T) {
+		// 与map对比随机的写入和删除
+		idx := newIndex()
+		model := make(map[string]*record.Pos)
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 20000; i++ {
+			key := []byte(fmt.Sprintf("key-%d", r.Intn(2000)))
+			key = key[:1+r.Intn(len(key))]
+			if r.Intn(3) == 0 {
+				err := idx.Delete(key)
+				if _, ok := model[string(key)]; ok != (err == nil) {
+					t.Fatalf("Delete %s mismatch: %v", key, err)
+				}
+				delete(model, string(key))
+				continue
+			}
+			pos := &record.Pos{Offset: int64(i)}
+			idx.Put(key, pos)
+			model[string(key)] = pos
+		}
+		if idx.Len() != len(model) {
+			t.Fatalf("Len mismatch: got %d, want %d", idx.Len(), len(model))
+		}
+		for key, want := range model {
+			if got, err := idx.Get([]byte(key)); err != nil || *got != *want {
+				t.Fatalf("Get %s mismatch: %v %v", key, got, err)
+			}
+		}
+		keys := make([]string, 0, len(model))
+		for key := range model {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		iter := idx.Iterator()
+		for _, key := range keys {
+			if !iter.Valid() || !bytes.Equal(iter.Key(), []byte(key)) || *iter.Value() != *model[key] {
+				t.Fatalf("iterator mismatch at %s", key)
+			}
+			iter.Next()
+		}
+		if iter.Valid() {
+			t.Fatal("iterator should be exhausted")
+		}
+
+		// 随机边界的逆序遍历
+		for i := 0; i < 50; i++ {
+			lower := []byte(fmt.Sprintf("key-%d", r.Intn(2000)))
+			upper := []byte(fmt.Sprintf("key-%d", r.Intn(2000)))
+			want := make([]string, 0)
+			for j := len(keys) - 1; j >= 0; j-- {
+				if keys[j] >= string(lower) && keys[j] < string(upper) {
+					want = append(want, keys[j])
+				}
+			}
+			got := make([]string, 0)
+			iter := idx.NewIterator(IterOptions{Lower: lower, Upper: upper, Reverse: true})
+			for ; iter.Valid(); iter.Next() {
+				got = append(got, string(iter.Key()))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("range [%s, %s) mismatch: got %d keys, want %d", lower, upper, len(got), len(want))
+			}
+		}
+	})
+
+	t.Run("Concurrent Access", func(t *testing.T) {
+		idx := newIndex()
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := []byte(fmt.Sprintf("key-%d-%d", w, i))
+					idx.Put(key, &record.Pos{Offset: int64(i)})
+					if _, err := idx.Get(key); err != nil {
+						t.Errorf("Get %s failed: %v", key, err)
+						return
+					}
+					if i%2 == 0 {
+						idx.Delete(key)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		if idx.Len() != 2000 {
+			t.Fatalf("Len mismatch: got %d, want 2000", idx.Len())
+		}
+	})
+}
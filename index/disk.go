@@ -0,0 +1,396 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// 页格式: count(2) used(2) next(4) entries...
+// entry格式: keySize(2) fileId(8) offset(8) size(8) key
+const (
+	diskPageHeaderLength  = 2 + 2 + 4
+	diskEntryHeaderLength = 2 + 8 + 8 + 8
+	diskInitialBuckets    = 16 // 初始桶数量
+	diskMaxLoad           = 48 // 平均每个桶的entry数超过该值时分裂一个桶
+
+	// DiskMaxKeySize 磁盘索引支持的最大key长度
+	DiskMaxKeySize = pageSize - diskPageHeaderLength - diskEntryHeaderLength
+	// DefaultDiskCachePages 磁盘索引默认缓存的页数
+	DefaultDiskCachePages = 1024
+)
+
+// DiskIndex 保存在磁盘文件中的线性哈希索引，内存中只缓存最近使用的页，
+// 可以保存超过内存大小的key，代价是未命中缓存时多一次磁盘读取。
+// 每个桶由一个主页和溢出页链表组成，平均负载超过diskMaxLoad时按顺序分裂一个桶。
+// 索引文件在启动时重建，不需要持久化；迭代和快照时对key排序，代价为O(n log n)，
+// key超过diskSortBufferSize时在临时文件中外部排序，内存占用与key的数量无关
+type DiskIndex struct {
+	mu      sync.Mutex // 读取也会修改页缓存，因此使用互斥锁
+	pager   *pager
+	buckets []uint32 // 桶号到主页的映射
+	level   uint     // 当前轮次，桶数量在每轮结束时翻倍
+	split   uint64   // 下一个要分裂的桶
+	size    int
+}
+
+// NewDiskIndex 在path创建磁盘索引，已存在的文件会被清空，cachePages为缓存的页数
+func NewDiskIndex(path string, cachePages int) (*DiskIndex, error) {
+	if cachePages <= 0 {
+		cachePages = DefaultDiskCachePages
+	}
+	p, err := newPager(path, cachePages)
+	if err != nil {
+		return nil, err
+	}
+	idx := &DiskIndex{pager: p}
+	for i := 0; i < diskInitialBuckets; i++ {
+		id, _, err := p.allocate()
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		idx.buckets = append(idx.buckets, id)
+	}
+	return idx, nil
+}
+
+// diskHash 计算key的FNV-1a哈希
+func diskHash(key []byte) uint64 {
+	var h uint64 = 14695981039346656037
+	for _, c := range key {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// bucket 返回key所在的桶，已分裂的桶使用下一轮的桶数量取模
+func (idx *DiskIndex) bucket(key []byte) uint64 {
+	h := diskHash(key)
+	n := uint64(diskInitialBuckets) << idx.level
+	if b := h % n; b >= idx.split {
+		return b
+	}
+	return h % (n << 1)
+}
+
+// 页头读写，第0页一定是主页，因此next为0表示没有溢出页
+func pageCount(data []byte) int          { return int(binary.BigEndian.Uint16(data[0:2])) }
+func pageUsed(data []byte) int           { return int(binary.BigEndian.Uint16(data[2:4])) }
+func pageNext(data []byte) uint32        { return binary.BigEndian.Uint32(data[4:8]) }
+func pageFree(data []byte) int           { return pageSize - diskPageHeaderLength - pageUsed(data) }
+func setPageNext(data []byte, id uint32) { binary.BigEndian.PutUint32(data[4:8], id) }
+
+func setPageHeader(data []byte, count, used int) {
+	binary.BigEndian.PutUint16(data[0:2], uint16(count))
+	binary.BigEndian.PutUint16(data[2:4], uint16(used))
+}
+
+// entryLength 返回off处entry的长度
+func entryLength(data []byte, off int) int {
+	return diskEntryHeaderLength + int(binary.BigEndian.Uint16(data[off:off+2]))
+}
+
+// entryKey 返回off处entry的key
+func entryKey(data []byte, off int) []byte {
+	keySize := int(binary.BigEndian.Uint16(data[off : off+2]))
+	start := off + diskEntryHeaderLength
+	return data[start : start+keySize]
+}
+
+// entryPos 返回off处entry的位置信息
+func entryPos(data []byte, off int) *record.Pos {
+	return &record.Pos{
+		FileID: int64(binary.BigEndian.Uint64(data[off+2 : off+10])),
+		Offset: int64(binary.BigEndian.Uint64(data[off+10 : off+18])),
+		Size:   int64(binary.BigEndian.Uint64(data[off+18 : off+26])),
+	}
+}
+
+// setEntryPos 覆盖off处entry的位置信息
+func setEntryPos(data []byte, off int, pos *record.Pos) {
+	binary.BigEndian.PutUint64(data[off+2:off+10], uint64(pos.FileID))
+	binary.BigEndian.PutUint64(data[off+10:off+18], uint64(pos.Offset))
+	binary.BigEndian.PutUint64(data[off+18:off+26], uint64(pos.Size))
+}
+
+// appendEntry 将entry追加到页尾，调用方需保证空间足够
+func appendEntry(data []byte, key []byte, pos *record.Pos) {
+	off := diskPageHeaderLength + pageUsed(data)
+	binary.BigEndian.PutUint16(data[off:off+2], uint16(len(key)))
+	setEntryPos(data, off, pos)
+	copy(data[off+diskEntryHeaderLength:], key)
+	setPageHeader(data, pageCount(data)+1, pageUsed(data)+diskEntryHeaderLength+len(key))
+}
+
+// findEntry 在页中查找key，不存在时返回-1
+func findEntry(data []byte, key []byte) int {
+	off := diskPageHeaderLength
+	end := off + pageUsed(data)
+	for off < end {
+		if bytes.Equal(entryKey(data, off), key) {
+			return off
+		}
+		off += entryLength(data, off)
+	}
+	return -1
+}
+
+// find 在桶中查找key，返回所在页和偏移，不存在时偏移为-1
+func (idx *DiskIndex) find(key []byte) (uint32, []byte, int, error) {
+	id := idx.buckets[idx.bucket(key)]
+	for {
+		data, err := idx.pager.get(id)
+		if err != nil {
+			return 0, nil, -1, err
+		}
+		if off := findEntry(data, key); off >= 0 {
+			return id, data, off, nil
+		}
+		next := pageNext(data)
+		if next == 0 {
+			return 0, nil, -1, nil
+		}
+		id = next
+	}
+}
+
+// Get 获取键对应的位置信息
+func (idx *DiskIndex) Get(key []byte) (*record.Pos, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	_, data, off, err := idx.find(key)
+	if err != nil {
+		return nil, err
+	}
+	if off < 0 {
+		return nil, ErrKeyNotFound
+	}
+	return entryPos(data, off), nil
+}
+
+// Put 将键值对的位置信息存入索引
+func (idx *DiskIndex) Put(key []byte, pos *record.Pos) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if pos == nil {
+		return ErrNilPos
+	}
+	if len(key) > DiskMaxKeySize {
+		return ErrKeyTooLarge
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	id, data, off, err := idx.find(key)
+	if err != nil {
+		return err
+	}
+	if off >= 0 {
+		setEntryPos(data, off, pos)
+		idx.pager.markDirty(id)
+		return nil
+	}
+
+	if err := idx.insert(idx.bucket(key), key, pos); err != nil {
+		return err
+	}
+	idx.size++
+	if idx.size > diskMaxLoad*len(idx.buckets) {
+		return idx.splitBucket()
+	}
+	return nil
+}
+
+// insert 将不存在的key写入桶中第一个有空间的页，都没有空间时追加溢出页
+func (idx *DiskIndex) insert(bucket uint64, key []byte, pos *record.Pos) error {
+	need := diskEntryHeaderLength + len(key)
+	id := idx.buckets[bucket]
+	for {
+		data, err := idx.pager.get(id)
+		if err != nil {
+			return err
+		}
+		if pageFree(data) >= need {
+			appendEntry(data, key, pos)
+			idx.pager.markDirty(id)
+			return nil
+		}
+		next := pageNext(data)
+		if next == 0 {
+			break
+		}
+		id = next
+	}
+
+	overflow, data, err := idx.pager.allocate()
+	if err != nil {
+		return err
+	}
+	appendEntry(data, key, pos)
+	// 分配新页可能淘汰旧页，需要重新读取链表尾部的页
+	last, err := idx.pager.get(id)
+	if err != nil {
+		return err
+	}
+	setPageNext(last, overflow)
+	idx.pager.markDirty(id)
+	return nil
+}
+
+// splitBucket 分裂split指向的桶，将其中的entry重新分配到原桶和新桶
+func (idx *DiskIndex) splitBucket() error {
+	old := idx.split
+	items := make([]*indexItem, 0)
+	id := idx.buckets[old]
+	for first := true; ; first = false {
+		data, err := idx.pager.get(id)
+		if err != nil {
+			return err
+		}
+		items = collectEntries(data, items, IterOptions{})
+		next := pageNext(data)
+		if first {
+			// 主页保留，清空后继续使用
+			setPageHeader(data, 0, 0)
+			setPageNext(data, 0)
+			idx.pager.markDirty(id)
+		} else {
+			idx.pager.release(id)
+		}
+		if next == 0 {
+			break
+		}
+		id = next
+	}
+
+	newId, _, err := idx.pager.allocate()
+	if err != nil {
+		return err
+	}
+	idx.buckets = append(idx.buckets, newId)
+	idx.split++
+	if idx.split == uint64(diskInitialBuckets)<<idx.level {
+		idx.level++
+		idx.split = 0
+	}
+
+	for _, item := range items {
+		if err := idx.insert(idx.bucket(item.key), item.key, item.pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectEntries 复制页中边界内的entry
+func collectEntries(data []byte, items []*indexItem, opts IterOptions) []*indexItem {
+	off := diskPageHeaderLength
+	end := off + pageUsed(data)
+	for off < end {
+		if key := entryKey(data, off); opts.inRange(key) {
+			items = append(items, &indexItem{
+				key: append([]byte(nil), key...),
+				pos: entryPos(data, off),
+			})
+		}
+		off += entryLength(data, off)
+	}
+	return items
+}
+
+// Delete 从索引中删除键，空出的溢出页在桶分裂时回收
+func (idx *DiskIndex) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	id, data, off, err := idx.find(key)
+	if err != nil {
+		return err
+	}
+	if off < 0 {
+		return ErrKeyNotFound
+	}
+	n := entryLength(data, off)
+	end := diskPageHeaderLength + pageUsed(data)
+	copy(data[off:], data[off+n:end])
+	setPageHeader(data, pageCount(data)-1, pageUsed(data)-n)
+	idx.pager.markDirty(id)
+	idx.size--
+	return nil
+}
+
+// Len 返回索引中的键值对数量
+func (idx *DiskIndex) Len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.size
+}
+
+// Iterator 返回遍历所有key的迭代器
+func (idx *DiskIndex) Iterator() IndexIter {
+	return idx.NewIterator(IterOptions{})
+}
+
+// NewIterator 返回迭代器，创建时对边界内的key排序，
+// 超过diskSortBufferSize时在索引文件所在目录中外部排序，内存中只保留每页的第一个key，
+// 关闭迭代器时删除排序文件
+func (idx *DiskIndex) NewIterator(opts IterOptions) IndexIter {
+	src, err := idx.sortedSource(opts)
+	if err != nil {
+		// 迭代器无法返回错误，读取失败时返回空迭代器
+		return newRangeIterator(newSliceSource(nil), opts)
+	}
+	if pages, ok := src.(*sortedPages); ok {
+		return &sortedIterator{rangeIterator: newRangeIterator(pages, opts), pages: pages}
+	}
+	return newRangeIterator(src, opts)
+}
+
+// sortedSource 对边界内的entry排序，外部排序失败时退回到在内存中排序
+func (idx *DiskIndex) sortedSource(opts IterOptions) (orderedSource, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if src, err := idx.sortEntries(opts, diskSortBufferSize); err == nil {
+		return src, nil
+	}
+	return idx.sortEntries(opts, 0)
+}
+
+// Snapshot 返回索引当前状态的只读副本，key较少时复制到btree中，
+// 否则保存在外部排序的临时文件中，不再使用时需要调用Close删除文件
+func (idx *DiskIndex) Snapshot() (Index, error) {
+	src, err := idx.sortedSource(IterOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if pages, ok := src.(*sortedPages); ok {
+		return &sortedIndex{pages: pages}, nil
+	}
+	snapshot := NewBTreeIndex(12)
+	for _, item := range src.(sliceSource) {
+		snapshot.items.ReplaceOrInsert(item)
+	}
+	return snapshot, nil
+}
+
+// Close 关闭并删除索引文件
+func (idx *DiskIndex) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.pager.close()
+}
@@ -0,0 +1,206 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+func TestDiskIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "disk_index_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("Small Cache", func(t *testing.T) {
+		// 只缓存4页，大部分读写都需要换页，同时触发多轮桶分裂
+		idx, err := NewDiskIndex(filepath.Join(dir, "small.idx"), 4)
+		if err != nil {
+			t.Fatalf("NewDiskIndex failed: %v", err)
+		}
+		defer idx.Close()
+
+		const n = 20000
+		for i := 0; i < n; i++ {
+			key := []byte(fmt.Sprintf("key-%06d", i))
+			if err := idx.Put(key, &record.Pos{FileID: int64(i % 7), Offset: int64(i), Size: 10}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		for i := 0; i < n; i += 2 {
+			if err := idx.Delete([]byte(fmt.Sprintf("key-%06d", i))); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+		}
+		if idx.Len() != n/2 {
+			t.Fatalf("Len mismatch: got %d, want %d", idx.Len(), n/2)
+		}
+		if len(idx.buckets) <= diskInitialBuckets*2 {
+			t.Fatalf("expected buckets to split, got %d", len(idx.buckets))
+		}
+		for i := 0; i < n; i++ {
+			pos, err := idx.Get([]byte(fmt.Sprintf("key-%06d", i)))
+			if i%2 == 0 {
+				if err != ErrKeyNotFound {
+					t.Fatalf("expected ErrKeyNotFound for %d, got %v", i, err)
+				}
+				continue
+			}
+			if err != nil || pos.Offset != int64(i) || pos.FileID != int64(i%7) {
+				t.Fatalf("Get %d mismatch: %v %v", i, pos, err)
+			}
+		}
+		if len(idx.pager.pages) > 4 {
+			t.Fatalf("cache exceeds capacity: %d", len(idx.pager.pages))
+		}
+	})
+
+	t.Run("Key Too Large", func(t *testing.T) {
+		idx, err := NewDiskIndex(filepath.Join(dir, "large.idx"), 0)
+		if err != nil {
+			t.Fatalf("NewDiskIndex failed: %v", err)
+		}
+		defer idx.Close()
+
+		if err := idx.Put(make([]byte, DiskMaxKeySize+1), &record.Pos{}); err != ErrKeyTooLarge {
+			t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+		}
+		key := make([]byte, DiskMaxKeySize)
+		key[0] = 1
+		if err := idx.Put(key, &record.Pos{Offset: 1}); err != nil {
+			t.Fatalf("Put max key failed: %v", err)
+		}
+		if pos, err := idx.Get(key); err != nil || pos.Offset != 1 {
+			t.Fatalf("Get max key mismatch: %v %v", pos, err)
+		}
+	})
+
+	t.Run("External Sort", func(t *testing.T) {
+		// 降低内存上限，迭代和快照都需要分段排序后归并
+		defer func(size int) { diskSortBufferSize = size }(diskSortBufferSize)
+		diskSortBufferSize = 16 << 10
+
+		sortDir := filepath.Join(dir, "sort")
+		if err := os.Mkdir(sortDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := NewDiskIndex(filepath.Join(sortDir, "sort.idx"), 4)
+		if err != nil {
+			t.Fatalf("NewDiskIndex failed: %v", err)
+		}
+		defer idx.Close()
+
+		const n = 5000
+		keyOf := func(i int) []byte {
+			key := fmt.Sprintf("key-%06d", i)
+			if i%100 == 0 {
+				// 较长的key使页中的entry数量不同
+				key += strings.Repeat("x", 1000)
+			}
+			return []byte(key)
+		}
+		for i := 0; i < n; i++ {
+			if err := idx.Put(keyOf(i), &record.Pos{Offset: int64(i)}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+		}
+		tempFiles := func() int {
+			matches, _ := filepath.Glob(filepath.Join(sortDir, "keydir-sorted-*"))
+			return len(matches)
+		}
+
+		iter := idx.NewIterator(IterOptions{})
+		if _, ok := iter.(*sortedIterator); !ok {
+			t.Fatalf("expected external sort, got %T", iter)
+		}
+		if tempFiles() != 1 {
+			t.Fatalf("expected one sorted file, got %d", tempFiles())
+		}
+		i := 0
+		for ; iter.Valid(); iter.Next() {
+			if string(iter.Key()) != string(keyOf(i)) || iter.Value().Offset != int64(i) {
+				t.Fatalf("iterator mismatch at %d: %.20s %v", i, iter.Key(), iter.Value())
+			}
+			i++
+		}
+		if i != n {
+			t.Fatalf("iterated %d keys, want %d", i, n)
+		}
+		iter.Seek(keyOf(1234))
+		if !iter.Valid() || string(iter.Key()) != string(keyOf(1234)) {
+			t.Fatalf("Seek mismatch: %.20s", iter.Key())
+		}
+		iter.Close()
+		if tempFiles() != 0 {
+			t.Fatalf("sorted file should be removed on Close, got %d", tempFiles())
+		}
+
+		iter = idx.NewIterator(IterOptions{Lower: keyOf(1000), Upper: keyOf(3000), Reverse: true})
+		i = 2999
+		for ; iter.Valid(); iter.Next() {
+			if string(iter.Key()) != string(keyOf(i)) {
+				t.Fatalf("reverse iterator mismatch at %d: %.20s", i, iter.Key())
+			}
+			i--
+		}
+		if i != 999 {
+			t.Fatalf("reverse iterator stopped at %d", i)
+		}
+		iter.Close()
+
+		snapshot := Snapshot(idx)
+		if _, ok := snapshot.(*sortedIndex); !ok {
+			t.Fatalf("expected sorted snapshot, got %T", snapshot)
+		}
+		idx.Delete(keyOf(10))
+		idx.Put(keyOf(n), &record.Pos{Offset: n})
+		if snapshot.Len() != n {
+			t.Fatalf("snapshot Len mismatch: %d", snapshot.Len())
+		}
+		for _, i := range []int{0, 10, 100, 2500, n - 1} {
+			if pos, err := snapshot.Get(keyOf(i)); err != nil || pos.Offset != int64(i) {
+				t.Fatalf("snapshot Get %d mismatch: %v %v", i, pos, err)
+			}
+		}
+		if _, err := snapshot.Get(keyOf(n)); err != ErrKeyNotFound {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+		if err := snapshot.Put(keyOf(n), &record.Pos{}); err != ErrReadOnly {
+			t.Fatalf("expected ErrReadOnly, got %v", err)
+		}
+		iter = snapshot.NewIterator(IterOptions{Lower: keyOf(n - 2)})
+		if !iter.Valid() || string(iter.Key()) != string(keyOf(n-2)) {
+			t.Fatalf("snapshot iterator mismatch: %.20s", iter.Key())
+		}
+		iter.Next()
+		iter.Next()
+		if iter.Valid() {
+			t.Fatalf("snapshot should not see keys put later, got %.20s", iter.Key())
+		}
+		iter.Close()
+		snapshot.(io.Closer).Close()
+		if tempFiles() != 0 {
+			t.Fatalf("sorted file should be removed when the snapshot is closed, got %d", tempFiles())
+		}
+	})
+
+	t.Run("Close Removes File", func(t *testing.T) {
+		path := filepath.Join(dir, "closed.idx")
+		idx, err := NewDiskIndex(path, 0)
+		if err != nil {
+			t.Fatalf("NewDiskIndex failed: %v", err)
+		}
+		if err := idx.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("index file should be removed, got %v", err)
+		}
+	})
+}
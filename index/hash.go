@@ -0,0 +1,119 @@
+package index
+
+import (
+	"sync"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+const hashShardCount = 64 // 分片数量，必须是2的幂
+
+// HashIndex 分片哈希索引，每个分片单独加锁，适合只做点查的场景。
+// 迭代时对所有key排序，代价为O(n log n)
+type HashIndex struct {
+	shards [hashShardCount]hashShard
+}
+
+// hashShard 哈希索引的一个分片
+type hashShard struct {
+	mu    sync.RWMutex
+	items map[string]*record.Pos
+}
+
+// NewHashIndex 创建分片哈希索引
+func NewHashIndex() *HashIndex {
+	idx := &HashIndex{}
+	for i := range idx.shards {
+		idx.shards[i].items = make(map[string]*record.Pos)
+	}
+	return idx
+}
+
+// shard 根据key的FNV-1a哈希选择分片
+func (idx *HashIndex) shard(key []byte) *hashShard {
+	var h uint32 = 2166136261
+	for _, c := range key {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return &idx.shards[h&(hashShardCount-1)]
+}
+
+// Get 获取键对应的位置信息
+func (idx *HashIndex) Get(key []byte) (*record.Pos, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	s := idx.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pos, ok := s.items[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return pos, nil
+}
+
+// Put 将键值对的位置信息存入索引
+func (idx *HashIndex) Put(key []byte, pos *record.Pos) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if pos == nil {
+		return ErrNilPos
+	}
+	s := idx.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[string(key)] = pos
+	return nil
+}
+
+// Delete 从索引中删除键
+func (idx *HashIndex) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	s := idx.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[string(key)]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(s.items, string(key))
+	return nil
+}
+
+// Len 返回索引中的键值对数量
+func (idx *HashIndex) Len() int {
+	n := 0
+	for i := range idx.shards {
+		s := &idx.shards[i]
+		s.mu.RLock()
+		n += len(s.items)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Iterator 返回遍历所有key的迭代器
+func (idx *HashIndex) Iterator() IndexIter {
+	return idx.NewIterator(IterOptions{})
+}
+
+// NewIterator 返回迭代器，创建时复制边界内的key并排序，
+// 各分片依次加锁复制，快照不保证是同一时刻的状态
+func (idx *HashIndex) NewIterator(opts IterOptions) IndexIter {
+	items := make([]*indexItem, 0)
+	for i := range idx.shards {
+		s := &idx.shards[i]
+		s.mu.RLock()
+		for key, pos := range s.items {
+			if opts.inRange([]byte(key)) {
+				items = append(items, &indexItem{key: []byte(key), pos: pos})
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return newRangeIterator(newSliceSource(items), opts)
+}
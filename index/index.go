@@ -1,6 +1,22 @@
 package index
 
-import "github.com/xia-Sang/bitcask/record"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var (
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrEmptyKey         = errors.New("key is empty")
+	ErrNilPos           = errors.New("pos is nil")
+	ErrUnknownIndexType = errors.New("unknown index type")
+	ErrKeyTooLarge      = errors.New("key is too large for index")
+	ErrReadOnly         = errors.New("index is read only")
+)
 
 type Index interface {
 	Get(key []byte) (pos *record.Pos, err error)
@@ -8,6 +24,7 @@ type Index interface {
 	Delete(key []byte) error
 	Len() int
 	Iterator() IndexIter
+	NewIterator(opts IterOptions) IndexIter
 }
 
 type IndexIter interface {
@@ -20,10 +37,73 @@ type IndexIter interface {
 	Close()
 }
 
-func NewIndex(typ string) Index {
+// DiskIndexFileName 磁盘索引在数据目录中的文件名
+const DiskIndexFileName = "keydir.idx"
+
+// Options 创建索引的选项，只有磁盘索引需要
+type Options struct {
+	Dir        string // 磁盘索引文件所在目录，为空时使用临时目录
+	CachePages int    // 磁盘索引缓存的页数，0表示使用默认值
+}
+
+// NewIndex 根据类型创建索引，支持btree、art、skiplist、hash和disk
+func NewIndex(typ string) (Index, error) {
+	return NewIndexWithOptions(typ, Options{})
+}
+
+// NewIndexWithOptions 根据类型和选项创建索引
+func NewIndexWithOptions(typ string, options Options) (Index, error) {
 	switch typ {
 	case "btree":
-		return NewBTreeIndex(12)
+		return NewBTreeIndex(12), nil
+	case "art":
+		return NewARTIndex(), nil
+	case "skiplist":
+		return NewSkipListIndex(), nil
+	case "hash":
+		return NewHashIndex(), nil
+	case "disk":
+		return newDiskIndexIn(options)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownIndexType, typ)
+}
+
+// Snapshot 返回索引当前状态的副本，btree使用写时复制，代价为O(1)；
+// 磁盘索引的key较多时保存在只读的临时文件中，副本实现io.Closer，不再使用时需要关闭；
+// 其他类型复制到新的btree中，代价为O(n)
+func Snapshot(idx Index) Index {
+	if bt, ok := idx.(*BTreeIndex); ok {
+		return bt.Clone()
+	}
+	if di, ok := idx.(*DiskIndex); ok {
+		if snapshot, err := di.Snapshot(); err == nil {
+			return snapshot
+		}
+	}
+	snapshot := NewBTreeIndex(12)
+	iter := idx.Iterator()
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		snapshot.items.ReplaceOrInsert(&indexItem{key: iter.Key(), pos: iter.Value()})
+	}
+	return snapshot
+}
+
+// newDiskIndexIn 在options.Dir中创建磁盘索引，未指定目录时使用临时文件
+func newDiskIndexIn(options Options) (*DiskIndex, error) {
+	if options.Dir != "" {
+		// 删除上次异常退出时遗留的排序文件
+		if matches, err := filepath.Glob(filepath.Join(options.Dir, sortedFilePattern)); err == nil {
+			for _, name := range matches {
+				os.Remove(name)
+			}
+		}
+		return NewDiskIndex(filepath.Join(options.Dir, DiskIndexFileName), options.CachePages)
+	}
+	f, err := os.CreateTemp("", "keydir-*.idx")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index file: %v", err)
 	}
-	return nil
+	f.Close()
+	return NewDiskIndex(f.Name(), options.CachePages)
 }
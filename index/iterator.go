@@ -0,0 +1,170 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// IterOptions 迭代器选项
+type IterOptions struct {
+	Lower   []byte // 下界（包含），nil表示不限制
+	Upper   []byte // 上界（不包含），nil表示不限制
+	Reverse bool   // 为true时按key从大到小遍历
+}
+
+// inRange 判断key是否在边界内
+func (o IterOptions) inRange(key []byte) bool {
+	if o.Lower != nil && bytes.Compare(key, o.Lower) < 0 {
+		return false
+	}
+	return o.Upper == nil || bytes.Compare(key, o.Upper) < 0
+}
+
+// orderedSource 有序的数据源，迭代器每移动一步查找一次，不需要复制全部数据
+type orderedSource interface {
+	// ceiling 返回第一个不小于key（strict时大于key）的项，key为nil时返回最小项
+	ceiling(key []byte, strict bool) *indexItem
+	// floor 返回最后一个不大于key（strict时小于key）的项，key为nil时返回最大项
+	floor(key []byte, strict bool) *indexItem
+}
+
+// rangeIterator 在有序数据源上按需查找的迭代器，
+// 正序时Next移动到更大的key，逆序时Next移动到更小的key，Prev与Next方向相反
+type rangeIterator struct {
+	src  orderedSource
+	opts IterOptions
+	curr *indexItem
+}
+
+// newRangeIterator 创建迭代器并定位到第一项
+func newRangeIterator(src orderedSource, opts IterOptions) *rangeIterator {
+	iter := &rangeIterator{src: src, opts: opts}
+	if opts.Reverse {
+		iter.set(src.floor(opts.Upper, opts.Upper != nil))
+	} else {
+		iter.set(src.ceiling(opts.Lower, false))
+	}
+	return iter
+}
+
+// set 设置当前项，超出边界时迭代器失效
+func (iter *rangeIterator) set(item *indexItem) {
+	if item != nil && !iter.opts.inRange(item.key) {
+		item = nil
+	}
+	iter.curr = item
+}
+
+// forward 移动到下一个更大的key
+func (iter *rangeIterator) forward() {
+	if iter.curr != nil {
+		iter.set(iter.src.ceiling(iter.curr.key, true))
+	}
+}
+
+// backward 移动到下一个更小的key
+func (iter *rangeIterator) backward() {
+	if iter.curr != nil {
+		iter.set(iter.src.floor(iter.curr.key, true))
+	}
+}
+
+func (iter *rangeIterator) Prev() {
+	if iter.opts.Reverse {
+		iter.forward()
+	} else {
+		iter.backward()
+	}
+}
+
+func (iter *rangeIterator) Next() {
+	if iter.opts.Reverse {
+		iter.backward()
+	} else {
+		iter.forward()
+	}
+}
+
+// Seek 正序时定位到第一个不小于key的项，逆序时定位到最后一个不大于key的项
+func (iter *rangeIterator) Seek(key []byte) {
+	if iter.src == nil {
+		return
+	}
+	if !iter.opts.Reverse {
+		if iter.opts.Lower != nil && bytes.Compare(key, iter.opts.Lower) < 0 {
+			key = iter.opts.Lower
+		}
+		iter.set(iter.src.ceiling(key, false))
+		return
+	}
+	if iter.opts.Upper != nil && bytes.Compare(key, iter.opts.Upper) >= 0 {
+		iter.set(iter.src.floor(iter.opts.Upper, true))
+		return
+	}
+	iter.set(iter.src.floor(key, false))
+}
+
+func (iter *rangeIterator) Valid() bool {
+	return iter.curr != nil
+}
+
+func (iter *rangeIterator) Key() []byte {
+	if iter.curr == nil {
+		return nil
+	}
+	return iter.curr.key
+}
+
+func (iter *rangeIterator) Value() *record.Pos {
+	if iter.curr == nil {
+		return nil
+	}
+	return iter.curr.pos
+}
+
+func (iter *rangeIterator) Close() {
+	iter.src = nil
+	iter.curr = nil
+}
+
+// sliceSource 按key有序的快照，用于本身无序的索引
+type sliceSource []*indexItem
+
+// newSliceSource 对边界内的项排序生成快照
+func newSliceSource(items []*indexItem) sliceSource {
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i].key, items[j].key) < 0
+	})
+	return items
+}
+
+func (s sliceSource) ceiling(key []byte, strict bool) *indexItem {
+	i := sort.Search(len(s), func(i int) bool {
+		c := bytes.Compare(s[i].key, key)
+		return c > 0 || (c == 0 && !strict)
+	})
+	if i < len(s) {
+		return s[i]
+	}
+	return nil
+}
+
+func (s sliceSource) floor(key []byte, strict bool) *indexItem {
+	if key == nil {
+		if len(s) == 0 {
+			return nil
+		}
+		return s[len(s)-1]
+	}
+	// 第一个大于key（strict时不小于key）的项之前的一项
+	i := sort.Search(len(s), func(i int) bool {
+		c := bytes.Compare(s[i].key, key)
+		return c > 0 || (c == 0 && strict)
+	})
+	if i > 0 {
+		return s[i-1]
+	}
+	return nil
+}
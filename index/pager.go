@@ -0,0 +1,118 @@
+package index
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+)
+
+const pageSize = 4096 // 页大小
+
+// pager 按页读写文件，只在内存中缓存最近使用的页，脏页在淘汰时写回
+type pager struct {
+	file      *os.File
+	pageCount uint32                   // 文件中的页数
+	capacity  int                      // 最多缓存的页数
+	pages     map[uint32]*list.Element // 页号到缓存的映射
+	lru       *list.List               // 最近使用的页在前
+	free      []uint32                 // 可以复用的页
+}
+
+// cachedPage 缓存的页
+type cachedPage struct {
+	id    uint32
+	data  []byte
+	dirty bool
+}
+
+// newPager 创建pager，文件已存在时清空
+func newPager(path string, capacity int) (*pager, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file: %v", err)
+	}
+	return &pager{
+		file:     file,
+		capacity: max(capacity, 2),
+		pages:    make(map[uint32]*list.Element),
+		lru:      list.New(),
+	}, nil
+}
+
+// get 读取页，返回的数据在下一次调用get或allocate之前有效
+func (p *pager) get(id uint32) ([]byte, error) {
+	if elem, ok := p.pages[id]; ok {
+		p.lru.MoveToFront(elem)
+		return elem.Value.(*cachedPage).data, nil
+	}
+	data := make([]byte, pageSize)
+	if _, err := p.file.ReadAt(data, int64(id)*pageSize); err != nil {
+		return nil, fmt.Errorf("failed to read index page %d: %v", id, err)
+	}
+	if err := p.cache(&cachedPage{id: id, data: data}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// markDirty 标记页已修改
+func (p *pager) markDirty(id uint32) {
+	if elem, ok := p.pages[id]; ok {
+		elem.Value.(*cachedPage).dirty = true
+	}
+}
+
+// allocate 分配一个空页，优先复用释放的页
+func (p *pager) allocate() (uint32, []byte, error) {
+	var id uint32
+	if n := len(p.free); n > 0 {
+		id = p.free[n-1]
+		p.free = p.free[:n-1]
+		if elem, ok := p.pages[id]; ok {
+			page := elem.Value.(*cachedPage)
+			clear(page.data)
+			page.dirty = true
+			p.lru.MoveToFront(elem)
+			return id, page.data, nil
+		}
+	} else {
+		id = p.pageCount
+		p.pageCount++
+	}
+	page := &cachedPage{id: id, data: make([]byte, pageSize), dirty: true}
+	if err := p.cache(page); err != nil {
+		return 0, nil, err
+	}
+	return id, page.data, nil
+}
+
+// release 释放页，之后可以被allocate复用
+func (p *pager) release(id uint32) {
+	p.free = append(p.free, id)
+}
+
+// cache 将页加入缓存，超出容量时淘汰最久未使用的页
+func (p *pager) cache(page *cachedPage) error {
+	p.pages[page.id] = p.lru.PushFront(page)
+	for p.lru.Len() > p.capacity {
+		elem := p.lru.Back()
+		evicted := elem.Value.(*cachedPage)
+		if evicted.dirty {
+			if _, err := p.file.WriteAt(evicted.data, int64(evicted.id)*pageSize); err != nil {
+				return fmt.Errorf("failed to write index page %d: %v", evicted.id, err)
+			}
+		}
+		p.lru.Remove(elem)
+		delete(p.pages, evicted.id)
+	}
+	return nil
+}
+
+// close 关闭并删除文件，索引在每次启动时重建，不需要保留
+func (p *pager) close() error {
+	name := p.file.Name()
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,206 @@
+package index
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+const (
+	skipListMaxLevel = 20 // 最大层数
+	skipListP        = 4  // 每层节点数约为下一层的1/4
+)
+
+// SkipListIndex 并发跳表索引，读取不加锁，写入之间互斥，适合写多读多的场景
+type SkipListIndex struct {
+	mu    sync.Mutex // 写锁
+	head  *skipListNode
+	level atomic.Int32
+	size  atomic.Int64
+}
+
+// skipListNode 跳表节点，next和pos使用原子操作，读取时不需要加锁
+type skipListNode struct {
+	key  []byte
+	pos  atomic.Pointer[record.Pos]
+	next []atomic.Pointer[skipListNode]
+}
+
+// NewSkipListIndex 创建跳表索引
+func NewSkipListIndex() *SkipListIndex {
+	idx := &SkipListIndex{
+		head: &skipListNode{next: make([]atomic.Pointer[skipListNode], skipListMaxLevel)},
+	}
+	idx.level.Store(1)
+	return idx
+}
+
+// randomLevel 随机生成新节点的层数
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Intn(skipListP) == 0 {
+		level++
+	}
+	return level
+}
+
+// findGreaterOrEqual 查找第一个不小于key的节点，prev不为nil时记录每一层的前驱节点
+func (idx *SkipListIndex) findGreaterOrEqual(key []byte, prev []*skipListNode) *skipListNode {
+	x := idx.head
+	for level := int(idx.level.Load()) - 1; level >= 0; level-- {
+		for {
+			next := x.next[level].Load()
+			if next == nil || bytes.Compare(next.key, key) >= 0 {
+				break
+			}
+			x = next
+		}
+		if prev != nil {
+			prev[level] = x
+		}
+	}
+	return x.next[0].Load()
+}
+
+// Get 获取键对应的位置信息
+func (idx *SkipListIndex) Get(key []byte) (*record.Pos, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	node := idx.findGreaterOrEqual(key, nil)
+	if node == nil || !bytes.Equal(node.key, key) {
+		return nil, ErrKeyNotFound
+	}
+	return node.pos.Load(), nil
+}
+
+// Put 将键值对的位置信息存入索引
+func (idx *SkipListIndex) Put(key []byte, pos *record.Pos) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if pos == nil {
+		return ErrNilPos
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	prev := make([]*skipListNode, skipListMaxLevel)
+	node := idx.findGreaterOrEqual(key, prev)
+	if node != nil && bytes.Equal(node.key, key) {
+		node.pos.Store(pos)
+		return nil
+	}
+
+	level := randomLevel()
+	if cur := int(idx.level.Load()); level > cur {
+		for i := cur; i < level; i++ {
+			prev[i] = idx.head
+		}
+		idx.level.Store(int32(level))
+	}
+	node = &skipListNode{
+		key:  key,
+		next: make([]atomic.Pointer[skipListNode], level),
+	}
+	node.pos.Store(pos)
+	// 先设置新节点的后继再链接到前驱，读取时总能看到完整的链表
+	for i := 0; i < level; i++ {
+		node.next[i].Store(prev[i].next[i].Load())
+		prev[i].next[i].Store(node)
+	}
+	idx.size.Add(1)
+	return nil
+}
+
+// Delete 从索引中删除键
+func (idx *SkipListIndex) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	prev := make([]*skipListNode, skipListMaxLevel)
+	node := idx.findGreaterOrEqual(key, prev)
+	if node == nil || !bytes.Equal(node.key, key) {
+		return ErrKeyNotFound
+	}
+	// 从上往下摘除，正在遍历该节点的读取仍然可以沿着它的后继继续
+	for i := len(node.next) - 1; i >= 0; i-- {
+		prev[i].next[i].Store(node.next[i].Load())
+	}
+	idx.size.Add(-1)
+	return nil
+}
+
+// Len 返回索引中的键值对数量
+func (idx *SkipListIndex) Len() int {
+	return int(idx.size.Load())
+}
+
+// Iterator 返回遍历所有key的迭代器
+func (idx *SkipListIndex) Iterator() IndexIter {
+	return idx.NewIterator(IterOptions{})
+}
+
+// NewIterator 返回迭代器，迭代器不加锁直接在跳表上查找，能看到创建之后的写入，
+// 每次移动和Seek的代价为O(log n)
+func (idx *SkipListIndex) NewIterator(opts IterOptions) IndexIter {
+	return newRangeIterator(skipListSource{idx: idx}, opts)
+}
+
+// skipListSource 在跳表上查找
+type skipListSource struct {
+	idx *SkipListIndex
+}
+
+func (s skipListSource) ceiling(key []byte, strict bool) *indexItem {
+	var node *skipListNode
+	if key == nil {
+		node = s.idx.head.next[0].Load()
+	} else {
+		node = s.idx.findGreaterOrEqual(key, nil)
+		if strict && node != nil && bytes.Equal(node.key, key) {
+			node = node.next[0].Load()
+		}
+	}
+	return node.item()
+}
+
+func (s skipListSource) floor(key []byte, strict bool) *indexItem {
+	// 从最高层开始查找最后一个满足条件的节点
+	x := s.idx.head
+	for level := int(s.idx.level.Load()) - 1; level >= 0; level-- {
+		for {
+			next := x.next[level].Load()
+			if next == nil {
+				break
+			}
+			if key != nil {
+				c := bytes.Compare(next.key, key)
+				if c > 0 || (c == 0 && strict) {
+					break
+				}
+			}
+			x = next
+		}
+	}
+	if x == s.idx.head {
+		return nil
+	}
+	return x.item()
+}
+
+// item 将节点转换为迭代器使用的项
+func (x *skipListNode) item() *indexItem {
+	if x == nil {
+		return nil
+	}
+	return &indexItem{key: x.key, pos: x.pos.Load()}
+}
@@ -0,0 +1,367 @@
+package index
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// diskSortBufferSize 磁盘索引排序时在内存中缓存的entry大小，超出时分段排序写入临时文件再归并
+var diskSortBufferSize = 4 << 20
+
+const (
+	diskSortItemOverhead = 64 // 内存中每个entry除key以外的估计大小
+	sortedCachePages     = 8  // 临时页文件缓存的页数
+
+	sortedFilePattern = "keydir-sorted-*.idx" // 排序文件名，与索引文件在同一目录
+)
+
+// sortedPages 按key有序保存entry的临时页文件，页格式与磁盘索引相同，
+// 内存中只保存每页的第一个key，查找时二分定位到页再读取
+type sortedPages struct {
+	mu     sync.Mutex // 查找也会修改页缓存
+	pager  *pager
+	firsts [][]byte // 每页的第一个key，下标即页号
+	sealed int      // 此前的页不再追加，用于在同一个文件中保存多段有序数据
+	count  int
+	closed bool
+}
+
+// newSortedPages 在dir中创建临时页文件
+func newSortedPages(dir string) (*sortedPages, error) {
+	f, err := os.CreateTemp(dir, sortedFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sorted index file: %v", err)
+	}
+	name := f.Name()
+	f.Close()
+	p, err := newPager(name, sortedCachePages)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	return &sortedPages{pager: p}, nil
+}
+
+// append 按key从小到大的顺序追加entry，当前页没有空间时分配新页
+func (s *sortedPages) append(key []byte, pos *record.Pos) error {
+	need := diskEntryHeaderLength + len(key)
+	if n := len(s.firsts); n > s.sealed {
+		data, err := s.pager.get(uint32(n - 1))
+		if err != nil {
+			return err
+		}
+		if pageFree(data) >= need {
+			appendEntry(data, key, pos)
+			s.pager.markDirty(uint32(n - 1))
+			s.count++
+			return nil
+		}
+	}
+	_, data, err := s.pager.allocate()
+	if err != nil {
+		return err
+	}
+	appendEntry(data, key, pos)
+	s.firsts = append(s.firsts, append([]byte(nil), key...))
+	s.count++
+	return nil
+}
+
+// startRun 之后追加的entry从新页开始，返回新一段的起始页
+func (s *sortedPages) startRun() int {
+	s.sealed = len(s.firsts)
+	return s.sealed
+}
+
+// copyEntry 复制off处的entry，页数据在下一次读取页之后失效
+func copyEntry(data []byte, off int) *indexItem {
+	return &indexItem{
+		key: append([]byte(nil), entryKey(data, off)...),
+		pos: entryPos(data, off),
+	}
+}
+
+func (s *sortedPages) ceiling(key []byte, strict bool) *indexItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := 0
+	if key != nil {
+		// 最后一个第一个key不大于key的页，目标在该页或下一页的开头
+		p = sort.Search(len(s.firsts), func(i int) bool {
+			return bytes.Compare(s.firsts[i], key) > 0
+		}) - 1
+		p = max(p, 0)
+	}
+	for ; p < len(s.firsts); p++ {
+		data, err := s.pager.get(uint32(p))
+		if err != nil {
+			return nil
+		}
+		end := diskPageHeaderLength + pageUsed(data)
+		for off := diskPageHeaderLength; off < end; off += entryLength(data, off) {
+			if key == nil {
+				return copyEntry(data, off)
+			}
+			if c := bytes.Compare(entryKey(data, off), key); c > 0 || (c == 0 && !strict) {
+				return copyEntry(data, off)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sortedPages) floor(key []byte, strict bool) *indexItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := len(s.firsts) - 1
+	if key != nil {
+		// 最后一个第一个key小于key（非strict时不大于key）的页
+		p = sort.Search(len(s.firsts), func(i int) bool {
+			c := bytes.Compare(s.firsts[i], key)
+			return c > 0 || (c == 0 && strict)
+		}) - 1
+	}
+	if p < 0 {
+		return nil
+	}
+	data, err := s.pager.get(uint32(p))
+	if err != nil {
+		return nil
+	}
+	found := -1
+	end := diskPageHeaderLength + pageUsed(data)
+	for off := diskPageHeaderLength; off < end; off += entryLength(data, off) {
+		if key != nil {
+			if c := bytes.Compare(entryKey(data, off), key); c > 0 || (c == 0 && strict) {
+				break
+			}
+		}
+		found = off
+	}
+	if found < 0 {
+		return nil
+	}
+	return copyEntry(data, found)
+}
+
+// close 关闭并删除临时文件，可以重复调用
+func (s *sortedPages) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.pager.close()
+}
+
+// runCursor 顺序读取临时文件中的一段有序entry，持有当前页的副本，
+// 归并时多个游标共用同一个页缓存
+type runCursor struct {
+	src  *sortedPages
+	page int // 下一个要读取的页
+	end  int // 段的结束页（不包含）
+	data []byte
+	off  int
+	item *indexItem // 当前entry，读完后为nil
+}
+
+// next 移动到下一个entry
+func (c *runCursor) next() error {
+	for {
+		if c.data != nil && c.off < diskPageHeaderLength+pageUsed(c.data) {
+			c.item = copyEntry(c.data, c.off)
+			c.off += entryLength(c.data, c.off)
+			return nil
+		}
+		if c.page >= c.end {
+			c.item = nil
+			return nil
+		}
+		data, err := c.src.pager.get(uint32(c.page))
+		if err != nil {
+			return err
+		}
+		c.data = append(c.data[:0], data...)
+		c.off = diskPageHeaderLength
+		c.page++
+	}
+}
+
+// cursorHeap 按当前key排序的游标堆
+type cursorHeap []*runCursor
+
+func (h cursorHeap) Len() int           { return len(h) }
+func (h cursorHeap) Less(i, j int) bool { return bytes.Compare(h[i].item.key, h[j].item.key) < 0 }
+func (h cursorHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x any)        { *h = append(*h, x.(*runCursor)) }
+func (h *cursorHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sortEntries 对边界内的entry排序，数据量不超过bufferSize时在内存中排序，
+// 否则分段排序后写入索引文件所在目录的临时文件，再归并为一个有序页文件，bufferSize为0时只在内存中排序。
+// 返回*sortedPages时调用方用完后需要关闭，调用方需持有锁
+func (idx *DiskIndex) sortEntries(opts IterOptions, bufferSize int) (orderedSource, error) {
+	dir := filepath.Dir(idx.pager.file.Name())
+	var (
+		items  []*indexItem
+		size   int
+		runs   *sortedPages
+		starts []int
+	)
+	// spill 将内存中的entry排序后作为一段写入临时文件
+	spill := func() error {
+		if runs == nil {
+			var err error
+			if runs, err = newSortedPages(dir); err != nil {
+				return err
+			}
+		}
+		starts = append(starts, runs.startRun())
+		for _, item := range newSliceSource(items) {
+			if err := runs.append(item.key, item.pos); err != nil {
+				return err
+			}
+		}
+		items, size = items[:0], 0
+		return nil
+	}
+	fail := func(err error) (orderedSource, error) {
+		if runs != nil {
+			runs.close()
+		}
+		return nil, err
+	}
+
+	for _, id := range idx.buckets {
+		for {
+			data, err := idx.pager.get(id)
+			if err != nil {
+				return fail(err)
+			}
+			n := len(items)
+			items = collectEntries(data, items, opts)
+			for _, item := range items[n:] {
+				size += len(item.key) + diskSortItemOverhead
+			}
+			if bufferSize > 0 && size >= bufferSize {
+				if err := spill(); err != nil {
+					return fail(err)
+				}
+			}
+			if id = pageNext(data); id == 0 {
+				break
+			}
+		}
+	}
+	if runs == nil {
+		return newSliceSource(items), nil
+	}
+	if len(items) > 0 {
+		if err := spill(); err != nil {
+			return fail(err)
+		}
+	}
+	defer runs.close()
+
+	// 归并所有段
+	h := make(cursorHeap, 0, len(starts))
+	for i, start := range starts {
+		end := len(runs.firsts)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		c := &runCursor{src: runs, page: start, end: end}
+		if err := c.next(); err != nil {
+			return fail(err)
+		}
+		if c.item != nil {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	out, err := newSortedPages(dir)
+	if err != nil {
+		return fail(err)
+	}
+	for h.Len() > 0 {
+		c := h[0]
+		if err := out.append(c.item.key, c.item.pos); err != nil {
+			out.close()
+			return fail(err)
+		}
+		if err := c.next(); err != nil {
+			out.close()
+			return fail(err)
+		}
+		if c.item == nil {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return out, nil
+}
+
+// sortedIterator 临时页文件上的迭代器，关闭时删除文件
+type sortedIterator struct {
+	*rangeIterator
+	pages *sortedPages
+}
+
+func (iter *sortedIterator) Close() {
+	iter.rangeIterator.Close()
+	iter.pages.close()
+}
+
+// sortedIndex 磁盘索引的只读快照，保存在临时页文件中，不再使用时需要调用Close删除文件
+type sortedIndex struct {
+	pages *sortedPages
+}
+
+func (s *sortedIndex) Get(key []byte) (*record.Pos, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	item := s.pages.ceiling(key, false)
+	if item == nil || !bytes.Equal(item.key, key) {
+		return nil, ErrKeyNotFound
+	}
+	return item.pos, nil
+}
+
+func (s *sortedIndex) Put(key []byte, pos *record.Pos) error {
+	return ErrReadOnly
+}
+
+func (s *sortedIndex) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+func (s *sortedIndex) Len() int {
+	return s.pages.count
+}
+
+func (s *sortedIndex) Iterator() IndexIter {
+	return s.NewIterator(IterOptions{})
+}
+
+// NewIterator 返回快照上的迭代器，迭代器不持有文件，关闭迭代器不影响快照
+func (s *sortedIndex) NewIterator(opts IterOptions) IndexIter {
+	return newRangeIterator(s.pages, opts)
+}
+
+func (s *sortedIndex) Close() error {
+	return s.pages.close()
+}
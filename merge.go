@@ -0,0 +1,358 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+const (
+	mergeDirName      = "data_merge"     // 合并输出目录
+	mergeFinishedName = "MERGE_FINISHED" // 合并完成标记文件
+)
+
+var (
+	ErrMergeInProgress = errors.New("merge is in progress")
+	ErrMergePending    = errors.New("previous merge is not installed, reopen the database")
+)
+
+// mergedRecord 合并过程中被搬迁的记录，newPos为nil表示记录已过期被丢弃
+type mergedRecord struct {
+	key    []byte
+	oldPos *record.Pos
+	newPos *record.Pos
+}
+
+// getMergeDir 获取合并目录路径
+func getMergeDir(dirPath string) string {
+	return filepath.Join(dirPath, mergeDirName)
+}
+
+// Merge 将所有已封存的wal文件中仍然有效的记录重写到新文件中，
+// 更新索引并删除旧文件，合并期间Put/Get可以正常进行，数据库已关闭时返回ErrClosed
+func (b *Bitcask) Merge() error {
+	if b.closed.Load() {
+		return ErrClosed
+	}
+	if !b.merging.CompareAndSwap(false, true) {
+		return ErrMergeInProgress
+	}
+	defer b.merging.Store(false)
+
+	// 获取需要合并的文件快照
+	b.mu.RLock()
+	sealedIds := make([]int64, 0, len(b.olderWal))
+	sealed := make(map[int64]*wal.WAL, len(b.olderWal))
+	for fileId, w := range b.olderWal {
+		sealedIds = append(sealedIds, fileId)
+		sealed[fileId] = w
+	}
+	b.mu.RUnlock()
+	if len(sealedIds) == 0 {
+		return nil
+	}
+	sort.Slice(sealedIds, func(i, j int) bool {
+		return sealedIds[i] < sealedIds[j]
+	})
+	b.metrics.mergeFiles.Store(int64(len(sealedIds)))
+	b.metrics.mergeFilesDone.Store(0)
+
+	mergeDir := getMergeDir(b.config.DirPath)
+	// 上次合并已完成但安装失败时，合并结果在下次启动时安装，不能清理
+	if _, _, err := readMergeFinished(mergeDir); err == nil {
+		return ErrMergePending
+	}
+	if err := os.RemoveAll(mergeDir); err != nil {
+		return fmt.Errorf("failed to clean merge directory: %v", err)
+	}
+	if err := os.MkdirAll(mergeDir, 0755); err != nil {
+		return fmt.Errorf("failed to create merge directory: %v", err)
+	}
+
+	moved, outIds, err := b.rewriteLiveRecords(mergeDir, sealedIds, sealed)
+	if err != nil {
+		os.RemoveAll(mergeDir)
+		return err
+	}
+
+	// 写入完成标记，记录被替换的最大文件id以及合并产生的文件id
+	if err := writeMergeFinished(mergeDir, sealedIds[len(sealedIds)-1], outIds); err != nil {
+		os.RemoveAll(mergeDir)
+		return fmt.Errorf("failed to write merge finished file: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 合并期间数据库已关闭，文件和目录锁都已释放，合并结果在下次启动时安装
+	if b.closed.Load() {
+		return ErrClosed
+	}
+
+	// 先安装并打开合并后的文件，失败时内存中的状态没有改变，
+	// 旧文件的句柄仍然可以读取，下次启动时再完成安装
+	if err := b.recoverMerge(); err != nil {
+		return fmt.Errorf("failed to install merged files: %v", err)
+	}
+	merged, err := b.openMergedFiles(outIds)
+	if err != nil {
+		return err
+	}
+
+	// 替换文件，被快照引用的旧文件在释放后关闭
+	for _, fileId := range sealedIds {
+		b.retire(sealed[fileId])
+		delete(b.olderWal, fileId)
+	}
+	for fileId, w := range merged {
+		b.olderWal[fileId] = w
+	}
+
+	// 只更新合并期间没有被修改过的key
+	for _, m := range moved {
+		cur, err := b.curIndex.Get(m.key)
+		if err != nil || !samePos(cur, m.oldPos) {
+			continue
+		}
+		if m.newPos == nil {
+			if err := b.indexDelete(m.key); err != nil {
+				return fmt.Errorf("failed to update index: %v", err)
+			}
+			continue
+		}
+		if err := b.indexPut(m.key, m.newPos); err != nil {
+			return fmt.Errorf("failed to update index: %v", err)
+		}
+	}
+	b.metrics.merges.Add(1)
+	return nil
+}
+
+// openMergedFiles 打开已安装到wal目录的合并文件，失败时关闭已打开的文件
+func (b *Bitcask) openMergedFiles(outIds []int64) (map[int64]*wal.WAL, error) {
+	walDir := getWalDir(b.config.DirPath)
+	merged := make(map[int64]*wal.WAL, len(outIds))
+	for _, fileId := range outIds {
+		walFile := filepath.Join(walDir, getWalFileName(fileId))
+		mergedWal, err := wal.NewWALWithOptions(walFile, fileId, b.walOptions())
+		if err != nil {
+			for _, w := range merged {
+				w.Close()
+			}
+			return nil, fmt.Errorf("failed to open merged wal file %s: %v", walFile, err)
+		}
+		merged[fileId] = mergedWal
+	}
+	return merged, nil
+}
+
+// rewriteLiveRecords 将有效记录写入合并目录，合并后的文件复用被合并文件的id
+func (b *Bitcask) rewriteLiveRecords(mergeDir string, sealedIds []int64, sealed map[int64]*wal.WAL) ([]mergedRecord, []int64, error) {
+	moved := make([]mergedRecord, 0)
+	outIds := []int64{sealedIds[0]}
+	out, err := wal.NewWALWithOptions(filepath.Join(mergeDir, getWalFileName(sealedIds[0])), sealedIds[0], b.mergeWalOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create merge file: %v", err)
+	}
+	defer func() {
+		if out != nil {
+			out.Close()
+		}
+	}()
+
+	now := time.Now().UnixNano()
+	for _, fileId := range sealedIds {
+		// 合并时不持有锁，只读遍历，不修改其他地方正在读取的wal的状态
+		err := sealed[fileId].Each(func(header *record.Header, pos *record.Pos) error {
+			if header.RecordType != record.RecordTypeNormal {
+				return nil
+			}
+			cur, err := b.curIndex.Get(header.Key)
+			if err != nil || !samePos(cur, pos) {
+				return nil
+			}
+
+			// 已过期的记录直接丢弃
+			if header.IsExpired(now) {
+				moved = append(moved, mergedRecord{
+					key:    append([]byte(nil), header.Key...),
+					oldPos: pos,
+				})
+				return nil
+			}
+
+			// 可用的文件id用完后，最后一个文件不再切换
+			if out.GetOffset() > b.config.MaxFileSize && len(outIds) < len(sealedIds) {
+				if err := sealMergeFile(mergeDir, out); err != nil {
+					return err
+				}
+				out.Close()
+				nextId := sealedIds[len(outIds)]
+				out, err = wal.NewWALWithOptions(filepath.Join(mergeDir, getWalFileName(nextId)), nextId, b.mergeWalOptions())
+				if err != nil {
+					return fmt.Errorf("failed to create merge file: %v", err)
+				}
+				outIds = append(outIds, nextId)
+			}
+
+			newPos, err := out.AppendRecord(header)
+			if err != nil {
+				return fmt.Errorf("failed to write merge file: %v", err)
+			}
+			b.metrics.mergeRecordsMoved.Add(1)
+			moved = append(moved, mergedRecord{
+				key:    append([]byte(nil), header.Key...),
+				oldPos: pos,
+				newPos: newPos,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to merge wal file %d: %v", fileId, err)
+		}
+		b.metrics.mergeFilesDone.Add(1)
+	}
+	if err := sealMergeFile(mergeDir, out); err != nil {
+		return nil, nil, err
+	}
+	return moved, outIds, nil
+}
+
+// mergeWalOptions 合并文件的写入选项，合并文件写完后统一同步
+func (b *Bitcask) mergeWalOptions() wal.Options {
+	options := b.walOptions()
+	options.SyncWrite = false
+	options.BytesPerSync = 0
+	return options
+}
+
+// sealMergeFile 同步合并文件并写入对应的hint文件
+func sealMergeFile(mergeDir string, out *wal.WAL) error {
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync merge file: %v", err)
+	}
+	hintFile := filepath.Join(mergeDir, getHintFileName(out.GetFileID()))
+	if err := out.WriteHint(hintFile); err != nil {
+		return fmt.Errorf("failed to write merge hint file: %v", err)
+	}
+	return nil
+}
+
+// writeMergeFinished 写入合并完成标记，第一行为被替换的最大文件id，第二行为合并产生的文件id
+func writeMergeFinished(mergeDir string, boundary int64, outIds []int64) error {
+	ids := make([]string, 0, len(outIds))
+	for _, fileId := range outIds {
+		ids = append(ids, strconv.FormatInt(fileId, 10))
+	}
+	content := strconv.FormatInt(boundary, 10) + "\n" + strings.Join(ids, ",")
+	return os.WriteFile(filepath.Join(mergeDir, mergeFinishedName), []byte(content), 0644)
+}
+
+// readMergeFinished 读取合并完成标记
+func readMergeFinished(mergeDir string) (int64, map[int64]bool, error) {
+	data, err := os.ReadFile(filepath.Join(mergeDir, mergeFinishedName))
+	if err != nil {
+		return 0, nil, err
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+	boundary, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid merge finished file: %v", err)
+	}
+	outIds := make(map[int64]bool)
+	if len(lines) == 2 {
+		for _, idStr := range strings.Split(strings.TrimSpace(lines[1]), ",") {
+			if idStr == "" {
+				continue
+			}
+			fileId, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid merge finished file: %v", err)
+			}
+			outIds[fileId] = true
+		}
+	}
+	return boundary, outIds, nil
+}
+
+// recoverMerge 将已完成的合并结果移动到wal目录，未完成的合并直接丢弃
+func (b *Bitcask) recoverMerge() error {
+	mergeDir := getMergeDir(b.config.DirPath)
+	if _, err := os.Stat(mergeDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	boundary, outIds, err := readMergeFinished(mergeDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.RemoveAll(mergeDir)
+		}
+		return err
+	}
+
+	// 先删除旧的hint文件，避免hint与数据文件不匹配
+	walDir := getWalDir(b.config.DirPath)
+	files, err := os.ReadDir(walDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fileId, ok, err := parseHintFileId(file.Name())
+		if err != nil {
+			return err
+		}
+		if !ok || fileId > boundary {
+			continue
+		}
+		if err := os.Remove(filepath.Join(walDir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	// 用合并后的文件覆盖同id的旧文件，再移动对应的hint文件
+	mergedFiles, err := os.ReadDir(mergeDir)
+	if err != nil {
+		return err
+	}
+	for _, parse := range []func(string) (int64, bool, error){parseWalFileId, parseHintFileId} {
+		for _, file := range mergedFiles {
+			if _, ok, _ := parse(file.Name()); !ok {
+				continue
+			}
+			if err := os.Rename(filepath.Join(mergeDir, file.Name()), filepath.Join(walDir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 删除其余已被合并的旧文件
+	files, err = os.ReadDir(walDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fileId, ok, err := parseWalFileId(file.Name())
+		if err != nil {
+			return err
+		}
+		if !ok || fileId > boundary || outIds[fileId] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(walDir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(mergeDir)
+}
+
+// samePos 判断两个位置是否指向同一条记录
+func samePos(a, b *record.Pos) bool {
+	return a != nil && b != nil && a.FileID == b.FileID && a.Offset == b.Offset
+}
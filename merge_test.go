@@ -0,0 +1,347 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+// dirSize 计算wal目录下所有文件的大小
+func dirSize(t *testing.T, dir string) int64 {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	var size int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			t.Fatalf("failed to stat file: %v", err)
+		}
+		size += info.Size()
+	}
+	return size
+}
+
+func TestBitcaskMerge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-merge-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+
+	// 反复覆盖写入并删除部分key，制造无效数据
+	ma := make(map[string][]byte)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+			if err := db.Put(key, value); err != nil {
+				t.Fatalf("failed to put: %v", err)
+			}
+			ma[string(key)] = value
+		}
+	}
+	for i := 0; i < 10; i++ {
+		key := utils.GenerateKey(i)
+		if err := db.Del(key); err != nil {
+			t.Fatalf("failed to del: %v", err)
+		}
+		delete(ma, string(key))
+	}
+
+	walDir := getWalDir(dir)
+	before := dirSize(t, walDir)
+	if err := db.Merge(); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	after := dirSize(t, walDir)
+	if after >= before {
+		t.Errorf("merge did not reclaim space: before %d, after %d", before, after)
+	}
+	if _, err := os.Stat(getMergeDir(dir)); !os.IsNotExist(err) {
+		t.Errorf("merge directory should be removed")
+	}
+
+	check := func(db *Bitcask) {
+		for i := 0; i < 50; i++ {
+			key := utils.GenerateKey(i)
+			value, ok := db.Get(key)
+			want, exist := ma[string(key)]
+			if ok != exist {
+				t.Fatalf("key %s existence mismatch: got %v, want %v", key, ok, exist)
+			}
+			if exist && !bytes.Equal(value, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+	check(db)
+
+	// 合并后继续写入
+	key, value := utils.GenerateKey(100), utils.GenerateValue(10)
+	if err := db.Put(key, value); err != nil {
+		t.Fatalf("failed to put after merge: %v", err)
+	}
+	ma[string(key)] = value
+	db.Close()
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	defer db.Close()
+	check(db)
+	if got, ok := db.Get(key); !ok || !bytes.Equal(got, value) {
+		t.Fatalf("value mismatch for key %s after reopen", key)
+	}
+}
+
+func TestBitcaskMergeRecovery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-merge-recovery-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := db.Put(utils.GenerateKey(i), utils.GenerateValue(10)); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+	}
+	db.Close()
+
+	// 模拟未完成的合并：合并目录中没有完成标记
+	mergeDir := getMergeDir(dir)
+	if err := os.MkdirAll(mergeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mergeDir, getWalFileName(0)), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	defer db.Close()
+	if _, err := os.Stat(mergeDir); !os.IsNotExist(err) {
+		t.Errorf("unfinished merge directory should be removed")
+	}
+	for i := 0; i < 30; i++ {
+		if _, ok := db.Get(utils.GenerateKey(i)); !ok {
+			t.Fatalf("failed to get key %d", i)
+		}
+	}
+}
+
+func TestBitcaskMergeConcurrent(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-merge-concurrent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewBitcask(&Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+	})
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer db.Close()
+
+	// 合并期间并发读取统计信息、备份和写入
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			db.Stats()
+			db.Put(utils.GenerateKey(i%50), utils.GenerateValue(10))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := db.BackupIncremental(filepath.Join(dir, "chain")); err != nil {
+				t.Errorf("BackupIncremental failed: %v", err)
+				return
+			}
+		}
+	}()
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 50; i++ {
+			db.Put(utils.GenerateKey(i), utils.GenerateValue(10))
+		}
+		if err := db.Merge(); err != nil {
+			t.Fatalf("failed to merge: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	for i := 0; i < 50; i++ {
+		if _, ok := db.Get(utils.GenerateKey(i)); !ok {
+			t.Fatalf("failed to get key %d", i)
+		}
+	}
+}
+
+func TestBitcaskMergeInstallFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-merge-install-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+	ma := make(map[string][]byte)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 30; i++ {
+			key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+			db.Put(key, value)
+			ma[string(key)] = value
+		}
+	}
+	check := func(t *testing.T) {
+		for key, want := range ma {
+			if got, ok := db.Get([]byte(key)); !ok || !bytes.Equal(got, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+	}
+
+	// 用非空目录占住旧的hint文件，安装合并结果时删除失败
+	hintFile := filepath.Join(getWalDir(dir), getHintFileName(0))
+	os.Remove(hintFile)
+	if err := os.MkdirAll(filepath.Join(hintFile, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Failed Install", func(t *testing.T) {
+		if err := db.Merge(); err == nil {
+			t.Fatal("expected merge install to fail")
+		}
+		// 安装失败时内存中的状态不变，可以继续读写
+		check(t)
+		key, value := utils.GenerateKey(100), utils.GenerateValue(10)
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("failed to put after failed merge: %v", err)
+		}
+		ma[string(key)] = value
+		check(t)
+
+		os.RemoveAll(hintFile)
+		if err := db.Merge(); !errors.Is(err, ErrMergePending) {
+			t.Fatalf("expected ErrMergePending, got %v", err)
+		}
+	})
+
+	t.Run("Install On Reopen", func(t *testing.T) {
+		db.Close()
+		db, err = NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		if _, err := os.Stat(getMergeDir(dir)); !os.IsNotExist(err) {
+			t.Fatal("merge directory should be installed on reopen")
+		}
+		check(t)
+		if err := db.Merge(); err != nil {
+			t.Fatalf("failed to merge after reopen: %v", err)
+		}
+		check(t)
+	})
+}
+
+func TestBitcaskMergeClose(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-merge-close-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	ma := make(map[string][]byte)
+	for round := 0; round < 5; round++ {
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to open bitcask: %v", err)
+		}
+		for key, want := range ma {
+			if got, ok := db.Get([]byte(key)); !ok || !bytes.Equal(got, want) {
+				t.Fatalf("value mismatch for key %s", key)
+			}
+		}
+		for i := 0; i < 50; i++ {
+			key, value := utils.GenerateKey(i), utils.GenerateValue(10)
+			db.Put(key, value)
+			ma[string(key)] = value
+		}
+
+		// 合并与关闭并发进行，关闭后合并不能再修改文件
+		done := make(chan error)
+		go func() {
+			done <- db.Merge()
+		}()
+		if err := db.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := <-done; err != nil && !errors.Is(err, ErrClosed) {
+			t.Logf("merge during close: %v", err)
+		}
+		if err := db.Merge(); !errors.Is(err, ErrClosed) {
+			t.Fatalf("expected ErrClosed, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// latencyBuckets 延迟直方图的桶上限，单位为秒
+var latencyBuckets = [...]float64{0.00001, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// histogram 固定桶的延迟直方图，每个桶只记录落在该桶中的次数，输出时再累加
+type histogram struct {
+	buckets [len(latencyBuckets)]atomic.Uint64
+	count   atomic.Uint64
+	sum     atomic.Int64 // 纳秒
+}
+
+// observe 记录一次耗时
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			h.buckets[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// opMetrics 单个操作的统计，批量写入和事务中的记录只计入次数，不计入延迟
+type opMetrics struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	latency histogram
+}
+
+// observe 记录一次操作的耗时和结果
+func (m *opMetrics) observe(start time.Time, failed bool) {
+	m.latency.observe(time.Since(start))
+	m.add(1, failed)
+}
+
+// add 记录n次没有单独计时的操作
+func (m *opMetrics) add(n int, failed bool) {
+	m.count.Add(uint64(n))
+	if failed {
+		m.errors.Add(uint64(n))
+	}
+}
+
+// metrics 运行统计，所有字段使用原子操作，不需要持有锁
+type metrics struct {
+	put       opMetrics
+	get       opMetrics // 只有读取或解码失败记为错误
+	del       opMetrics
+	getMisses atomic.Uint64 // key不存在或已过期的get次数
+
+	fsyncErrors atomic.Uint64
+	fsync       histogram
+
+	walRotations atomic.Uint64
+
+	merges            atomic.Uint64 // 完成的合并次数
+	mergeFiles        atomic.Int64  // 当前或上一次合并的文件数
+	mergeFilesDone    atomic.Int64  // 当前或上一次合并已处理的文件数
+	mergeRecordsMoved atomic.Uint64 // 合并重写的记录数
+}
+
+// observeSync 记录一次文件同步
+func (m *metrics) observeSync(d time.Duration, err error) {
+	m.fsync.observe(d)
+	if err != nil {
+		m.fsyncErrors.Add(1)
+	}
+}
+
+// observeBatch 将批量写入或事务中的记录按类型计入put和del
+func (m *metrics) observeBatch(records []*record.Header, failed bool) {
+	puts := 0
+	for _, r := range records {
+		if r.RecordType == record.RecordTypeNormal {
+			puts++
+		}
+	}
+	m.put.add(puts, failed)
+	m.del.add(len(records)-puts, failed)
+}
+
+// WriteMetrics 以Prometheus文本格式写出运行统计和存储统计
+func (b *Bitcask) WriteMetrics(w io.Writer) error {
+	m := &b.metrics
+	stats := b.Stats()
+	buf := &bytes.Buffer{}
+
+	ops := []struct {
+		label string
+		m     *opMetrics
+	}{{`op="put"`, &m.put}, {`op="get"`, &m.get}, {`op="del"`, &m.del}}
+	writeFamily(buf, "bitcask_operations_total", "counter", "Number of Put, Get and Del operations, records in batches and transactions included.")
+	for _, op := range ops {
+		writeSample(buf, "bitcask_operations_total", op.label, float64(op.m.count.Load()))
+	}
+	writeFamily(buf, "bitcask_operation_errors_total", "counter", "Number of operations that failed with an error.")
+	for _, op := range ops {
+		writeSample(buf, "bitcask_operation_errors_total", op.label, float64(op.m.errors.Load()))
+	}
+	writeFamily(buf, "bitcask_get_misses_total", "counter", "Number of Get operations for missing or expired keys.")
+	writeSample(buf, "bitcask_get_misses_total", "", float64(m.getMisses.Load()))
+	writeFamily(buf, "bitcask_operation_duration_seconds", "histogram", "Latency of single Put, Get and Del calls.")
+	for _, op := range ops {
+		writeHistogram(buf, "bitcask_operation_duration_seconds", op.label, &op.m.latency)
+	}
+
+	writeFamily(buf, "bitcask_fsync_total", "counter", "Number of fsync calls on data files.")
+	writeSample(buf, "bitcask_fsync_total", "", float64(m.fsync.count.Load()))
+	writeFamily(buf, "bitcask_fsync_errors_total", "counter", "Number of failed fsync calls.")
+	writeSample(buf, "bitcask_fsync_errors_total", "", float64(m.fsyncErrors.Load()))
+	writeFamily(buf, "bitcask_fsync_duration_seconds", "histogram", "Latency of fsync calls on data files.")
+	writeHistogram(buf, "bitcask_fsync_duration_seconds", "", &m.fsync)
+
+	writeFamily(buf, "bitcask_wal_rotations_total", "counter", "Number of times the active wal file was sealed.")
+	writeSample(buf, "bitcask_wal_rotations_total", "", float64(m.walRotations.Load()))
+
+	merging := 0.0
+	if b.merging.Load() {
+		merging = 1
+	}
+	writeFamily(buf, "bitcask_merge_running", "gauge", "Whether a merge is in progress.")
+	writeSample(buf, "bitcask_merge_running", "", merging)
+	writeFamily(buf, "bitcask_merges_total", "counter", "Number of completed merges.")
+	writeSample(buf, "bitcask_merges_total", "", float64(m.merges.Load()))
+	writeFamily(buf, "bitcask_merge_files", "gauge", "Number of files in the current or last merge.")
+	writeSample(buf, "bitcask_merge_files", "", float64(m.mergeFiles.Load()))
+	writeFamily(buf, "bitcask_merge_files_done", "gauge", "Number of files processed by the current or last merge.")
+	writeSample(buf, "bitcask_merge_files_done", "", float64(m.mergeFilesDone.Load()))
+	writeFamily(buf, "bitcask_merge_records_moved_total", "counter", "Number of records rewritten by merges.")
+	writeSample(buf, "bitcask_merge_records_moved_total", "", float64(m.mergeRecordsMoved.Load()))
+
+	writeFamily(buf, "bitcask_index_keys", "gauge", "Number of keys in the index.")
+	writeSample(buf, "bitcask_index_keys", "", float64(stats.KeyCount))
+	writeFamily(buf, "bitcask_data_files", "gauge", "Number of wal files.")
+	writeSample(buf, "bitcask_data_files", "", float64(stats.DataFiles))
+	writeFamily(buf, "bitcask_data_bytes", "gauge", "Size of wal files by state.")
+	writeSample(buf, "bitcask_data_bytes", `state="total"`, float64(stats.TotalBytes))
+	writeSample(buf, "bitcask_data_bytes", `state="live"`, float64(stats.LiveBytes))
+	writeSample(buf, "bitcask_data_bytes", `state="dead"`, float64(stats.DeadBytes))
+	writeFamily(buf, "bitcask_tombstones", "gauge", "Number of tombstones in wal files.")
+	writeSample(buf, "bitcask_tombstones", "", float64(stats.Tombstones))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MetricsHandler 返回输出Prometheus文本格式统计的http.Handler
+func (b *Bitcask) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := b.WriteMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// writeFamily 写出指标的HELP和TYPE行
+func writeFamily(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample 写出一个样本，labels为空表示没有标签
+func writeSample(buf *bytes.Buffer, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// writeHistogram 写出直方图的累计桶、总和和次数
+func writeHistogram(buf *bytes.Buffer, name, labels string, h *histogram) {
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	// 先读取次数，保证+Inf桶不小于其他桶
+	count := h.count.Load()
+	var cumulative uint64
+	for i, le := range latencyBuckets {
+		cumulative += h.buckets[i].Load()
+		writeSample(buf, name+"_bucket", prefix+`le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(min(cumulative, count)))
+	}
+	writeSample(buf, name+"_bucket", prefix+`le="+Inf"`, float64(count))
+	writeSample(buf, name+"_sum", labels, time.Duration(h.sum.Load()).Seconds())
+	writeSample(buf, name+"_count", labels, float64(count))
+}
@@ -0,0 +1,159 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskMetrics(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-metrics-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewBitcask(&Config{
+		DirPath:     dir,
+		MaxFileSize: 1024,
+		IndexType:   "btree",
+		SyncPolicy:  SyncAlways,
+	})
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		db.Put(utils.GenerateKey(i), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		db.Get(utils.GenerateKey(i))
+	}
+	db.Get([]byte("missing"))
+	for i := 0; i < 10; i++ {
+		db.Del(utils.GenerateKey(i))
+	}
+	db.Put(nil, []byte("value"))
+
+	// 流式写入、修改过期时间、批量写入和事务中的记录也计入put和del
+	if err := db.PutReader(utils.GenerateKey(100), strings.NewReader("stream"), 6); err != nil {
+		t.Fatalf("PutReader failed: %v", err)
+	}
+	if err := db.Expire(utils.GenerateKey(20), time.Hour); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	db.Expire([]byte("missing"), time.Hour)
+	batch := db.NewBatch()
+	batch.Put(utils.GenerateKey(101), []byte("batch"))
+	batch.Delete(utils.GenerateKey(10))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if err := db.Update(func(tx *Txn) error {
+		return tx.Put(utils.GenerateKey(102), []byte("txn"))
+	}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// 流式读取与Get一样计入统计
+	rc, err := db.GetReader(utils.GenerateKey(50))
+	if err != nil {
+		t.Fatalf("GetReader failed: %v", err)
+	}
+	rc.Close()
+	if _, err := db.GetReader([]byte("missing")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	scrape := func(t *testing.T) string {
+		rec := httptest.NewRecorder()
+		db.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Fatalf("unexpected content type: %s", rec.Header().Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+
+	t.Run("Samples", func(t *testing.T) {
+		body := scrape(t)
+		for _, want := range []string{
+			`bitcask_operations_total{op="put"} 105`,
+			`bitcask_operations_total{op="get"} 103`,
+			`bitcask_operations_total{op="del"} 11`,
+			`bitcask_operation_errors_total{op="put"} 1`,
+			`bitcask_operation_errors_total{op="get"} 0`,
+			`bitcask_get_misses_total 2`,
+			`bitcask_operation_duration_seconds_bucket{op="put",le="+Inf"} 103`,
+			`bitcask_operation_duration_seconds_count{op="del"} 10`,
+			`bitcask_merges_total 1`,
+			`bitcask_merge_running 0`,
+			`bitcask_index_keys 92`,
+		} {
+			if !strings.Contains(body, want+"\n") {
+				t.Fatalf("missing %q in:\n%s", want, body)
+			}
+		}
+		for _, re := range []string{
+			`bitcask_fsync_total [1-9]`,
+			`bitcask_wal_rotations_total [1-9]`,
+			`bitcask_merge_records_moved_total [1-9]`,
+		} {
+			if !regexp.MustCompile(re).MatchString(body) {
+				t.Fatalf("missing %q in:\n%s", re, body)
+			}
+		}
+		files := regexp.MustCompile(`bitcask_merge_files (\d+)`).FindStringSubmatch(body)
+		done := regexp.MustCompile(`bitcask_merge_files_done (\d+)`).FindStringSubmatch(body)
+		if files == nil || done == nil || files[1] != done[1] || files[1] == "0" {
+			t.Fatalf("merge progress mismatch: %v %v", files, done)
+		}
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		// 每个样本行都是 name{labels} value，且属于之前声明过TYPE的指标
+		sample := regexp.MustCompile(`^([a-z_]+)(\{[a-z]+="[^"]*"(,[a-z]+="[^"]*")*\})? [-+0-9.eE]+$`)
+		declared := make(map[string]bool)
+		var lastLe float64
+		for _, line := range strings.Split(strings.TrimSpace(scrape(t)), "\n") {
+			if strings.HasPrefix(line, "# TYPE ") {
+				declared[strings.Fields(line)[2]] = true
+				continue
+			}
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			m := sample.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("invalid sample line %q", line)
+			}
+			name := regexp.MustCompile(`_(bucket|sum|count)$`).ReplaceAllString(m[1], "")
+			if !declared[m[1]] && !declared[name] {
+				t.Fatalf("sample without TYPE: %q", line)
+			}
+			// 直方图的桶是累计的
+			if strings.HasSuffix(m[1], "_bucket") {
+				var v float64
+				fmt.Sscan(line[strings.LastIndex(line, " ")+1:], &v)
+				if strings.Contains(line, `le="1e-05"`) {
+					lastLe = 0
+				}
+				if v < lastLe {
+					t.Fatalf("buckets should be cumulative: %q", line)
+				}
+				lastLe = v
+			}
+		}
+	})
+}
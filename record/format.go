@@ -0,0 +1,120 @@
+package record
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// 记录格式版本
+const (
+	FormatV0      uint16 = 0        // 旧格式，文件没有文件头
+	FormatV1      uint16 = 1        // 带文件头，记录中包含序列号和时间戳
+	FormatCurrent uint16 = FormatV1 // 新文件使用的格式
+)
+
+// v1记录格式:
+// recordType(1) flags(1) keySize(4) valueSize(4) seq(8) timestamp(8) expireAt(8) key value crc32(4)
+const HeaderLengthV1 = 1 + 1 + 4 + 4 + 8 + 8 + 8
+
+// FixedHeaderLength 返回指定版本记录头中固定部分的长度
+func FixedHeaderLength(version uint16) int64 {
+	if version == FormatV0 {
+		return HeaderLength
+	}
+	return HeaderLengthV1
+}
+
+// PeekSize 根据记录头的固定部分解析key、value长度以及整条记录的长度
+func PeekSize(fixed []byte, version uint16) (keySize int64, valueSize int64, total int64) {
+	if version == FormatV0 {
+		_, hasExpire := DecodeType(fixed[0])
+		keySize = int64(binary.BigEndian.Uint32(fixed[1:5]))
+		valueSize = int64(binary.BigEndian.Uint32(fixed[5:9]))
+		total = HeaderLength + keySize + valueSize + CrcLength
+		if hasExpire {
+			total += ExpireAtLength
+		}
+		return keySize, valueSize, total
+	}
+	keySize = int64(binary.BigEndian.Uint32(fixed[2:6]))
+	valueSize = int64(binary.BigEndian.Uint32(fixed[6:10]))
+	total = HeaderLengthV1 + keySize + valueSize + CrcLength
+	return keySize, valueSize, total
+}
+
+// Encode 按指定版本序列化记录
+func (h *Header) Encode(version uint16) []byte {
+	if version == FormatV0 {
+		return h.ToBytes()
+	}
+
+	length := HeaderLengthV1 + len(h.Key) + len(h.Value) + CrcLength
+	buf := make([]byte, length)
+	copy(buf, h.EncodePrefix(int64(len(h.Value))))
+	copy(buf[HeaderLengthV1+len(h.Key):], h.Value)
+
+	crc := crc32.ChecksumIEEE(buf[:length-CrcLength])
+	binary.BigEndian.PutUint32(buf[length-CrcLength:], crc)
+	return buf
+}
+
+// EncodePrefix 序列化v1记录中value之前的部分，即记录头和key，
+// 用于流式写入时value不在内存中的情况
+func (h *Header) EncodePrefix(valueSize int64) []byte {
+	buf := make([]byte, HeaderLengthV1+len(h.Key))
+	buf[0] = byte(h.RecordType)
+	buf[1] = byte(h.Flags)
+	binary.BigEndian.PutUint32(buf[2:6], uint32(len(h.Key)))
+	binary.BigEndian.PutUint32(buf[6:10], uint32(valueSize))
+	binary.BigEndian.PutUint64(buf[10:18], h.Seq)
+	binary.BigEndian.PutUint64(buf[18:26], uint64(h.Timestamp))
+	binary.BigEndian.PutUint64(buf[26:34], uint64(h.ExpireAt))
+	copy(buf[HeaderLengthV1:], h.Key)
+	return buf
+}
+
+// DecodePrefix 解析v1记录的记录头，不包含key和value
+func DecodePrefix(fixed []byte) *Header {
+	if len(fixed) < HeaderLengthV1 {
+		return nil
+	}
+	return &Header{
+		RecordType: RecordType(fixed[0]),
+		Flags:      Flags(fixed[1]),
+		Seq:        binary.BigEndian.Uint64(fixed[10:18]),
+		Timestamp:  int64(binary.BigEndian.Uint64(fixed[18:26])),
+		ExpireAt:   int64(binary.BigEndian.Uint64(fixed[26:34])),
+	}
+}
+
+// Decode 按指定版本反序列化记录，数据不完整或校验失败时返回nil
+func Decode(data []byte, version uint16) *Header {
+	if version == FormatV0 {
+		return FromBytes(data)
+	}
+
+	if len(data) < HeaderLengthV1+CrcLength {
+		return nil
+	}
+	keySize, valueSize, total := PeekSize(data, version)
+	if int64(len(data)) < total {
+		return nil
+	}
+	crc := binary.BigEndian.Uint32(data[total-CrcLength : total])
+	if crc != crc32.ChecksumIEEE(data[:total-CrcLength]) {
+		return nil
+	}
+
+	header := &Header{
+		RecordType: RecordType(data[0]),
+		Flags:      Flags(data[1]),
+		Seq:        binary.BigEndian.Uint64(data[10:18]),
+		Timestamp:  int64(binary.BigEndian.Uint64(data[18:26])),
+		ExpireAt:   int64(binary.BigEndian.Uint64(data[26:34])),
+		Key:        make([]byte, keySize),
+		Value:      make([]byte, valueSize),
+	}
+	copy(header.Key, data[HeaderLengthV1:HeaderLengthV1+keySize])
+	copy(header.Value, data[HeaderLengthV1+keySize:HeaderLengthV1+keySize+valueSize])
+	return header
+}
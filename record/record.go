@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
+	"math"
 )
 
 type RecordType byte
@@ -15,33 +16,100 @@ const (
 	RecordTypeTransactionBegin                      // 事务开始
 	RecordTypeTransactionCommit                     // 事务提交
 	RecordTypeTransactionRollback                   // 事务回滚
+	RecordTypeExpiring                              // 带过期时间的正常记录，只用于编码
 )
 
+const (
+	MaxKeySize   = math.MaxUint32 // key长度字段为uint32
+	MaxValueSize = math.MaxUint32 // value长度字段为uint32
+)
+
+const (
+	HeaderLength   = 1 + 4 + 4 // recordType(1) + keySize(4) + valueSize(4)
+	ExpireAtLength = 8         // 过期时间
+	CrcLength      = 4         // crc32
+)
+
+// Flags 记录标志位，只在v1及以后的格式中保存
+type Flags byte
+
+const (
+	FlagCompressed Flags = 1 << iota // value已压缩，第一个字节为压缩算法id
+	FlagBlob                         // value保存在blob文件中，记录中只保存指针
+)
+
+// Has 判断是否设置了指定标志位
+func (f Flags) Has(flag Flags) bool {
+	return f&flag != 0
+}
+
 // Header 记录头
 type Header struct {
 	Key        []byte     // 键
 	Value      []byte     // 值
 	RecordType RecordType // 记录类型
+	ExpireAt   int64      // 过期时间(UnixNano)，0表示永不过期
+	Flags      Flags      // 标志位
+	Seq        uint64     // 序列号
+	Timestamp  int64      // 写入时间(UnixNano)
 }
 
 // String 实现 Stringer 接口
 func (h *Header) String() string {
+	if h.ExpireAt != 0 {
+		return fmt.Sprintf("Key: %s, Value: %s, RecordType: %d, ExpireAt: %d", h.Key, h.Value, h.RecordType, h.ExpireAt)
+	}
 	return fmt.Sprintf("Key: %s, Value: %s, RecordType: %d", h.Key, h.Value, h.RecordType)
 }
 
+// IsExpired 判断记录在now时刻是否已过期
+func (h *Header) IsExpired(now int64) bool {
+	return IsExpired(h.ExpireAt, now)
+}
+
+// IsExpired 判断过期时间在now时刻是否已过期
+func IsExpired(expireAt int64, now int64) bool {
+	return expireAt != 0 && expireAt <= now
+}
+
+// EncodeType 编码记录类型字节，带有过期时间的正常记录编码为RecordTypeExpiring
+func EncodeType(typ RecordType, expireAt int64) byte {
+	if typ == RecordTypeNormal && expireAt != 0 {
+		return byte(RecordTypeExpiring)
+	}
+	return byte(typ)
+}
+
+// DecodeType 解码记录类型字节，返回记录类型以及是否带有过期时间
+func DecodeType(b byte) (RecordType, bool) {
+	if RecordType(b) == RecordTypeExpiring {
+		return RecordTypeNormal, true
+	}
+	return RecordType(b), false
+}
+
 // ToBytes 实现转为bytes
-// recordtype keysize valuesize key value crc32
+// recordtype keysize valuesize [expireAt] key value crc32
 func (h *Header) ToBytes() []byte {
-	// 1.计算总长度：recordType(1) + keySize(4) + valueSize(4) + key + value + crc32(4)
-	headerLength := 1 + 4 + 4 + len(h.Key) + len(h.Value) + 4
+	// 1.计算总长度：recordType(1) + keySize(4) + valueSize(4) + [expireAt(8)] + key + value + crc32(4)
+	typ := EncodeType(h.RecordType, h.ExpireAt)
+	extraLength := 0
+	if RecordType(typ) == RecordTypeExpiring {
+		extraLength = ExpireAtLength
+	}
+	headerLength := HeaderLength + extraLength + len(h.Key) + len(h.Value) + CrcLength
 	buf := make([]byte, headerLength)
 
 	// 2.写入数据
-	buf[0] = byte(h.RecordType)
+	buf[0] = typ
 	binary.BigEndian.PutUint32(buf[1:5], uint32(len(h.Key)))
 	binary.BigEndian.PutUint32(buf[5:9], uint32(len(h.Value)))
-	copy(buf[9:9+len(h.Key)], h.Key)
-	copy(buf[9+len(h.Key):9+len(h.Key)+len(h.Value)], h.Value)
+	if extraLength != 0 {
+		binary.BigEndian.PutUint64(buf[9:17], uint64(h.ExpireAt))
+	}
+	n := HeaderLength + extraLength
+	copy(buf[n:n+len(h.Key)], h.Key)
+	copy(buf[n+len(h.Key):n+len(h.Key)+len(h.Value)], h.Value)
 
 	// 3.计算并写入crc32（不包含crc32字段本身）
 	crc := crc32.ChecksumIEEE(buf[:headerLength-4])
@@ -52,29 +120,38 @@ func (h *Header) ToBytes() []byte {
 
 func FromBytes(data []byte) *Header {
 	header := &Header{}
-	if len(data) < 9 { // 至少需要recordType(1) + keySize(4) + valueSize(4)
+	if len(data) < HeaderLength { // 至少需要recordType(1) + keySize(4) + valueSize(4)
 		return nil
 	}
 
-	header.RecordType = RecordType(data[0])
-	keySize := binary.BigEndian.Uint32(data[1:5])
-	valueSize := binary.BigEndian.Uint32(data[5:9])
+	recordType, hasExpire := DecodeType(data[0])
+	header.RecordType = recordType
+	keySize := uint64(binary.BigEndian.Uint32(data[1:5]))
+	valueSize := uint64(binary.BigEndian.Uint32(data[5:9]))
+	var n uint64 = HeaderLength
+	if hasExpire {
+		if len(data) < HeaderLength+ExpireAtLength {
+			return nil
+		}
+		header.ExpireAt = int64(binary.BigEndian.Uint64(data[9:17]))
+		n += ExpireAtLength
+	}
 
 	// 验证数据长度是否足够
-	expectedLen := 9 + keySize + valueSize + 4 // header(9) + key + value + crc32(4)
-	if uint32(len(data)) < expectedLen {
+	expectedLen := n + keySize + valueSize + CrcLength // header + key + value + crc32(4)
+	if uint64(len(data)) < expectedLen {
 		return nil
 	}
 
 	// 读取key和value
 	header.Key = make([]byte, keySize)
 	header.Value = make([]byte, valueSize)
-	copy(header.Key, data[9:9+keySize])
-	copy(header.Value, data[9+keySize:9+keySize+valueSize])
+	copy(header.Key, data[n:n+keySize])
+	copy(header.Value, data[n+keySize:n+keySize+valueSize])
 
 	// 验证CRC32
-	crc := binary.BigEndian.Uint32(data[9+keySize+valueSize:])
-	if crc != crc32.ChecksumIEEE(data[:9+keySize+valueSize]) {
+	crc := binary.BigEndian.Uint32(data[n+keySize+valueSize:])
+	if crc != crc32.ChecksumIEEE(data[:n+keySize+valueSize]) {
 		return nil
 	}
 
@@ -175,6 +175,76 @@ func TestRecordSerialization(t *testing.T) {
 		})
 	})
 
+	t.Run("Expire At", func(t *testing.T) {
+		header := &Header{
+			Key:        []byte("key"),
+			Value:      []byte("value"),
+			RecordType: RecordTypeNormal,
+			ExpireAt:   1700000000000000000,
+		}
+
+		data := header.ToBytes()
+		if RecordType(data[0]) != RecordTypeExpiring {
+			t.Errorf("Encoded type mismatch: got %d, want %d", data[0], RecordTypeExpiring)
+		}
+		result := FromBytes(data)
+		if result == nil {
+			t.Fatal("FromBytes() returned nil")
+		}
+		if result.RecordType != RecordTypeNormal {
+			t.Errorf("RecordType mismatch: got %d, want %d", result.RecordType, RecordTypeNormal)
+		}
+		if result.ExpireAt != header.ExpireAt {
+			t.Errorf("ExpireAt mismatch: got %d, want %d", result.ExpireAt, header.ExpireAt)
+		}
+		if !bytes.Equal(result.Value, header.Value) {
+			t.Errorf("Value mismatch: got %s, want %s", result.Value, header.Value)
+		}
+		if !result.IsExpired(header.ExpireAt) || result.IsExpired(header.ExpireAt-1) {
+			t.Error("IsExpired returned wrong result")
+		}
+	})
+
+	t.Run("Format V1", func(t *testing.T) {
+		header := &Header{
+			Key:        []byte("key"),
+			Value:      []byte("value"),
+			RecordType: RecordTypeNormal,
+			Flags:      Flags(1),
+			Seq:        42,
+			Timestamp:  1700000000000000000,
+			ExpireAt:   1800000000000000000,
+		}
+
+		data := header.Encode(FormatV1)
+		keySize, valueSize, total := PeekSize(data[:FixedHeaderLength(FormatV1)], FormatV1)
+		if keySize != 3 || valueSize != 5 || total != int64(len(data)) {
+			t.Errorf("PeekSize mismatch: got %d %d %d", keySize, valueSize, total)
+		}
+		result := Decode(data, FormatV1)
+		if result == nil {
+			t.Fatal("Decode() returned nil")
+		}
+		if result.Seq != header.Seq || result.Timestamp != header.Timestamp ||
+			result.ExpireAt != header.ExpireAt || result.Flags != header.Flags {
+			t.Errorf("Header mismatch: got %+v, want %+v", result, header)
+		}
+		if !bytes.Equal(result.Key, header.Key) || !bytes.Equal(result.Value, header.Value) {
+			t.Errorf("Key/Value mismatch: got %s/%s", result.Key, result.Value)
+		}
+
+		// 校验失败时返回nil
+		data[HeaderLengthV1] ^= 0xff
+		if Decode(data, FormatV1) != nil {
+			t.Error("Decode() should return nil for corrupted data")
+		}
+
+		// v0格式与ToBytes一致
+		if !bytes.Equal(header.Encode(FormatV0), header.ToBytes()) {
+			t.Error("Encode(FormatV0) should match ToBytes()")
+		}
+	})
+
 	t.Run("String Representation", func(t *testing.T) {
 		header := &Header{
 			Key:        []byte("test_key"),
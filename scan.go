@@ -0,0 +1,198 @@
+package bitcask
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+var ErrIteratorClosed = errors.New("iterator is closed")
+
+// ScanOptions 范围扫描选项
+type ScanOptions struct {
+	Reverse bool // 为true时按key从大到小遍历
+	Limit   int  // 最多返回的键值对数量，0表示不限制
+}
+
+// reader 迭代器读取数据的来源，数据库读取最新的状态，快照读取创建时的状态
+type reader interface {
+	// newIndexIterator 返回索引上的迭代器
+	newIndexIterator(opts index.IterOptions) index.IndexIter
+	// loadHeader 读取key的记录头和位置，不读取value，已删除或已过期时返回false
+	loadHeader(key []byte) (*record.Header, *record.Pos, bool)
+	// loadValue 读取key在pos处记录的value，保存在blob文件中时读取blob
+	loadValue(key []byte, pos *record.Pos) ([]byte, error)
+}
+
+// Iterator 遍历键值对的迭代器，只跳过已删除和已过期的key，
+// value在调用Value时才读取，保存在blob文件中的value不会提前读取。
+// 迭代器不持有锁，每次移动时从数据库或快照中读取key的记录头
+type Iterator struct {
+	r      reader
+	iter   index.IndexIter
+	limit  int
+	count  int
+	header *record.Header // 当前key的记录头，不包含value
+	pos    *record.Pos    // 当前key的记录位置
+}
+
+// newIterator 创建遍历[start, end)范围的迭代器
+func newIterator(r reader, start, end []byte, opts ScanOptions) *Iterator {
+	it := &Iterator{
+		r: r,
+		iter: r.newIndexIterator(index.IterOptions{
+			Lower:   start,
+			Upper:   end,
+			Reverse: opts.Reverse,
+		}),
+		limit: opts.Limit,
+	}
+	it.skip()
+	return it
+}
+
+// newPrefixIterator 创建遍历key以prefix开头的键值对的迭代器
+func newPrefixIterator(r reader, prefix []byte, opts ScanOptions) *Iterator {
+	if len(prefix) == 0 {
+		return newIterator(r, nil, nil, opts)
+	}
+	return newIterator(r, prefix, prefixEnd(prefix), opts)
+}
+
+// Scan 遍历[start, end)范围内的键值对，start或end为nil表示不限制
+func (b *Bitcask) Scan(start, end []byte, opts ScanOptions) *Iterator {
+	return newIterator(b, start, end, opts)
+}
+
+// ScanPrefix 遍历key以prefix开头的键值对
+func (b *Bitcask) ScanPrefix(prefix []byte, opts ScanOptions) *Iterator {
+	return newPrefixIterator(b, prefix, opts)
+}
+
+func (b *Bitcask) newIndexIterator(opts index.IterOptions) index.IndexIter {
+	return b.curIndex.NewIterator(opts)
+}
+
+// loadHeader 读取key当前的记录头，迭代器创建后key可能已被覆盖、删除或合并到新文件
+func (b *Bitcask) loadHeader(key []byte) (*record.Header, *record.Pos, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	pos, err := b.curIndex.Get(key)
+	if err != nil {
+		return nil, nil, false
+	}
+	walFile, err := b.getWalFile(pos.FileID)
+	if err != nil {
+		return nil, nil, false
+	}
+	header, ok := readLiveHeader(walFile, pos, time.Now().UnixNano())
+	return header, pos, ok
+}
+
+// loadValue 读取key当前的value，合并会复用文件id，定位后pos可能已指向其他记录，
+// 因此按key重新查找位置，key在定位后被删除或已过期时返回ErrKeyNotFound
+func (b *Bitcask) loadValue(key []byte, _ *record.Pos) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	value, ok, err := b.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return value, nil
+}
+
+// readLiveHeader 读取wal中记录的记录头，已删除或在now时已过期的记录视为不存在
+func readLiveHeader(walFile *wal.WAL, pos *record.Pos, now int64) (*record.Header, bool) {
+	header, err := walFile.ReadRecordHeader(pos)
+	if err != nil || header.RecordType == record.RecordTypeDeleted {
+		return nil, false
+	}
+	if header.IsExpired(now) {
+		return nil, false
+	}
+	return header, true
+}
+
+// prefixEnd 返回比所有以prefix开头的key都大的最小key，prefix全为0xff时返回nil
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// skip 跳过已删除或已过期的key，定位到下一个可以返回的key
+func (it *Iterator) skip() {
+	it.header, it.pos = nil, nil
+	if it.limit > 0 && it.count >= it.limit {
+		return
+	}
+	for ; it.iter.Valid(); it.iter.Next() {
+		if header, pos, ok := it.r.loadHeader(it.iter.Key()); ok {
+			it.header, it.pos = header, pos
+			it.count++
+			return
+		}
+	}
+}
+
+// Valid 迭代器是否指向一个键值对
+func (it *Iterator) Valid() bool {
+	return it.header != nil
+}
+
+// Next 移动到下一个键值对
+func (it *Iterator) Next() {
+	if it.header == nil {
+		return
+	}
+	it.iter.Next()
+	it.skip()
+}
+
+// Seek 正序时定位到第一个不小于key的键值对，逆序时定位到最后一个不大于key的键值对
+func (it *Iterator) Seek(key []byte) {
+	if it.iter == nil {
+		return
+	}
+	it.iter.Seek(key)
+	it.skip()
+}
+
+// Key 返回当前的key，调用方不能修改
+func (it *Iterator) Key() []byte {
+	if it.header == nil {
+		return nil
+	}
+	return it.header.Key
+}
+
+// Value 读取当前的value
+func (it *Iterator) Value() ([]byte, error) {
+	if it.iter == nil {
+		return nil, ErrIteratorClosed
+	}
+	if it.header == nil {
+		return nil, ErrKeyNotFound
+	}
+	return it.r.loadValue(it.header.Key, it.pos)
+}
+
+// Close 关闭迭代器
+func (it *Iterator) Close() {
+	if it.iter != nil {
+		it.iter.Close()
+		it.iter = nil
+	}
+	it.header, it.pos = nil, nil
+}
@@ -0,0 +1,174 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+func TestBitcaskScan(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-scan-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:       dir,
+		MaxFileSize:   1024,
+		IndexType:     "btree",
+		BlobThreshold: 1024,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	for _, key := range []string{"a", "user:1", "user:2", "user:3", "user;", "video:1", "\xff", "\xff\xff"} {
+		db.Put([]byte(key), []byte("value-"+key))
+	}
+	collect := func(it *Iterator) []string {
+		defer it.Close()
+		keys := make([]string, 0)
+		for ; it.Valid(); it.Next() {
+			value, err := it.Value()
+			if err != nil || string(value) != "value-"+string(it.Key()) {
+				t.Fatalf("value mismatch for %s: %s %v", it.Key(), value, err)
+			}
+			keys = append(keys, string(it.Key()))
+		}
+		return keys
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		tests := []struct {
+			start, end []byte
+			opts       ScanOptions
+			want       string
+		}{
+			{[]byte("user:"), []byte("video"), ScanOptions{}, "[user:1 user:2 user:3 user;]"},
+			{[]byte("user:2"), nil, ScanOptions{Limit: 2}, "[user:2 user:3]"},
+			{nil, []byte("user:2"), ScanOptions{Reverse: true}, "[user:1 a]"},
+			{[]byte("user:1"), []byte("user:3"), ScanOptions{Reverse: true, Limit: 1}, "[user:2]"},
+			{[]byte("z"), []byte("a"), ScanOptions{}, "[]"},
+		}
+		for _, tt := range tests {
+			if got := fmt.Sprint(collect(db.Scan(tt.start, tt.end, tt.opts))); got != tt.want {
+				t.Errorf("Scan(%q, %q, %+v): got %s, want %s", tt.start, tt.end, tt.opts, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		if got := fmt.Sprint(collect(db.ScanPrefix([]byte("user:"), ScanOptions{}))); got != "[user:1 user:2 user:3]" {
+			t.Fatalf("ScanPrefix mismatch: %s", got)
+		}
+		if got := fmt.Sprint(collect(db.ScanPrefix([]byte("user:"), ScanOptions{Reverse: true, Limit: 2}))); got != "[user:3 user:2]" {
+			t.Fatalf("reverse ScanPrefix mismatch: %s", got)
+		}
+		// 全为0xff的前缀没有上界
+		if got := fmt.Sprint(collect(db.ScanPrefix([]byte("\xff"), ScanOptions{}))); got != fmt.Sprint([]string{"\xff", "\xff\xff"}) {
+			t.Fatalf("ScanPrefix 0xff mismatch: %q", got)
+		}
+	})
+
+	t.Run("Seek", func(t *testing.T) {
+		it := db.ScanPrefix([]byte("user:"), ScanOptions{})
+		defer it.Close()
+		it.Seek([]byte("user:20"))
+		if !it.Valid() || string(it.Key()) != "user:3" {
+			t.Fatalf("Seek mismatch: %s", it.Key())
+		}
+		it.Next()
+		if it.Valid() {
+			t.Fatalf("iterator should stop at the prefix end, got %s", it.Key())
+		}
+	})
+
+	t.Run("Skip Deleted And Expired", func(t *testing.T) {
+		db.Put([]byte("tmp:1"), []byte("value-tmp:1"))
+		db.Put([]byte("tmp:2"), []byte("value-tmp:2"))
+		db.Put([]byte("tmp:3"), []byte("value-tmp:3"))
+		db.PutWithTTL([]byte("tmp:4"), []byte("value-tmp:4"), time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		it := db.ScanPrefix([]byte("tmp:"), ScanOptions{Limit: 2})
+		// 迭代器创建后删除的key也会被跳过
+		db.Del([]byte("tmp:2"))
+		if got := fmt.Sprint(collect(it)); got != "[tmp:1 tmp:3]" {
+			t.Fatalf("scan mismatch: %s", got)
+		}
+	})
+
+	t.Run("Lazy Blob Value", func(t *testing.T) {
+		large := bytes.Repeat([]byte("x"), 4096)
+		db.Put([]byte("blob:1"), large)
+		it := db.ScanPrefix([]byte("blob:"), ScanOptions{})
+		defer it.Close()
+		if !it.Valid() {
+			t.Fatal("iterator should be valid")
+		}
+		value, err := it.Value()
+		if err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("blob value mismatch: %d %v", len(value), err)
+		}
+		it.Close()
+		if _, err := it.Value(); !errors.Is(err, ErrIteratorClosed) {
+			t.Fatalf("expected ErrIteratorClosed, got %v", err)
+		}
+	})
+
+	t.Run("Lazy Inline Value", func(t *testing.T) {
+		key := []byte("lazy:1")
+		db.Put(key, []byte("value-lazy:1"))
+		pos, err := db.curIndex.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 损坏value中的一个字节，移动迭代器时不读取value，不受影响
+		f, err := os.OpenFile(filepath.Join(getWalDir(dir), getWalFileName(pos.FileID)), os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		offset := pos.Offset + record.HeaderLengthV1 + int64(len(key))
+		orig := make([]byte, 1)
+		f.ReadAt(orig, offset)
+		f.WriteAt([]byte{orig[0] ^ 0xff}, offset)
+		defer f.WriteAt(orig, offset)
+
+		it := db.ScanPrefix([]byte("lazy:"), ScanOptions{})
+		defer it.Close()
+		if !it.Valid() || !bytes.Equal(it.Key(), key) {
+			t.Fatal("iterator should stop at the key with a corrupted value")
+		}
+		var corrupted *wal.CorruptedError
+		if _, err := it.Value(); !errors.As(err, &corrupted) {
+			t.Fatalf("expected CorruptedError from Value, got %v", err)
+		}
+	})
+
+	t.Run("After Merge", func(t *testing.T) {
+		it := db.ScanPrefix([]byte("user:"), ScanOptions{})
+		defer it.Close()
+		for i := 0; i < 50; i++ {
+			db.Put([]byte("user:1"), []byte("value-user:1"))
+		}
+		if err := db.Merge(); err != nil {
+			t.Fatalf("merge failed: %v", err)
+		}
+		if got := fmt.Sprint(collect(it)); got != "[user:1 user:2 user:3]" {
+			t.Fatalf("scan after merge mismatch: %s", got)
+		}
+	})
+}
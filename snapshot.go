@@ -0,0 +1,193 @@
+package bitcask
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+var ErrSnapshotReleased = errors.New("snapshot is released")
+
+// Snapshot 数据库在某一时刻的只读视图，之后的写入、合并和blob回收都不影响快照的读取。
+// 快照引用创建时的所有wal和blob文件，被合并或回收的文件在快照释放后才关闭，
+// 已删除的文件通过打开的文件描述符继续读取。使用完后需要调用Release
+type Snapshot struct {
+	db    *Bitcask
+	index index.Index
+	files map[int64]*wal.WAL // 创建时的wal文件
+	blobs map[int64]*wal.WAL // 创建时的blob文件
+	now   int64              // 创建时间，用于判断记录是否过期
+
+	released bool // 由db.mu保护
+}
+
+// Snapshot 创建当前状态的快照，btree索引的代价为O(1)，其他索引需要复制
+func (b *Bitcask) Snapshot() *Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Snapshot{
+		db:    b,
+		index: index.Snapshot(b.curIndex),
+		files: make(map[int64]*wal.WAL, len(b.olderWal)+1),
+		blobs: make(map[int64]*wal.WAL, len(b.blobs)),
+		now:   time.Now().UnixNano(),
+	}
+	for fileId, w := range b.olderWal {
+		s.files[fileId] = w
+	}
+	if b.activeWal != nil {
+		s.files[b.fileId] = b.activeWal
+	}
+	for fileId, blob := range b.blobs {
+		s.blobs[fileId] = blob
+	}
+	for _, w := range s.files {
+		b.pins[w]++
+	}
+	for _, blob := range s.blobs {
+		b.pins[blob]++
+	}
+	return s
+}
+
+// retire 关闭不再使用的文件，仍被快照引用时推迟到快照释放后关闭，调用方需持有写锁
+func (b *Bitcask) retire(w *wal.WAL) {
+	if b.pins[w] > 0 {
+		b.retired[w] = true
+		return
+	}
+	w.Close()
+}
+
+// unpin 释放快照对文件的引用，调用方需持有写锁
+func (b *Bitcask) unpin(w *wal.WAL) {
+	b.pins[w]--
+	if b.pins[w] > 0 {
+		return
+	}
+	delete(b.pins, w)
+	if b.retired[w] {
+		delete(b.retired, w)
+		w.Close()
+	}
+}
+
+// Release 释放快照，之后快照不能再读取
+func (s *Snapshot) Release() {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.released = true
+	for _, w := range s.files {
+		s.db.unpin(w)
+	}
+	for _, blob := range s.blobs {
+		s.db.unpin(blob)
+	}
+	s.files = nil
+	s.blobs = nil
+	// 磁盘索引的快照保存在临时文件中
+	if c, ok := s.index.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// Get 读取快照创建时key对应的value
+func (s *Snapshot) Get(key []byte) ([]byte, bool) {
+	header, ok := s.loadRecord(key)
+	if !ok {
+		return nil, false
+	}
+	if err := s.loadBlob(header); err != nil {
+		return nil, false
+	}
+	return header.Value, true
+}
+
+// Scan 遍历快照中[start, end)范围内的键值对，start或end为nil表示不限制
+func (s *Snapshot) Scan(start, end []byte, opts ScanOptions) *Iterator {
+	return newIterator(s, start, end, opts)
+}
+
+// ScanPrefix 遍历快照中key以prefix开头的键值对
+func (s *Snapshot) ScanPrefix(prefix []byte, opts ScanOptions) *Iterator {
+	return newPrefixIterator(s, prefix, opts)
+}
+
+func (s *Snapshot) newIndexIterator(opts index.IterOptions) index.IndexIter {
+	return s.index.NewIterator(opts)
+}
+
+// loadRecord 读取快照中key的记录，活跃文件可能仍在写入，因此需要持有读锁
+func (s *Snapshot) loadRecord(key []byte) (*record.Header, bool) {
+	pos, err := s.index.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	if s.released {
+		return nil, false
+	}
+	w, ok := s.files[pos.FileID]
+	if !ok {
+		return nil, false
+	}
+	return readLiveRecord(w, pos, s.now)
+}
+
+// loadHeader 读取快照中key的记录头和位置，不读取value
+func (s *Snapshot) loadHeader(key []byte) (*record.Header, *record.Pos, bool) {
+	pos, err := s.index.Get(key)
+	if err != nil {
+		return nil, nil, false
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	if s.released {
+		return nil, nil, false
+	}
+	w, ok := s.files[pos.FileID]
+	if !ok {
+		return nil, nil, false
+	}
+	header, ok := readLiveHeader(w, pos, s.now)
+	return header, pos, ok
+}
+
+// loadValue 读取快照中pos处记录的value，快照引用的文件不会被合并修改，pos始终有效
+func (s *Snapshot) loadValue(key []byte, pos *record.Pos) ([]byte, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	if s.released {
+		return nil, ErrSnapshotReleased
+	}
+	w, ok := s.files[pos.FileID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	header, err := w.ReadRecord(pos)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveBlobIn(s.blobs, header); err != nil {
+		return nil, err
+	}
+	return header.Value, nil
+}
+
+func (s *Snapshot) loadBlob(header *record.Header) error {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	if s.released {
+		return ErrSnapshotReleased
+	}
+	return resolveBlobIn(s.blobs, header)
+}
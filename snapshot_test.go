@@ -0,0 +1,151 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskSnapshot(t *testing.T) {
+	for _, typ := range []string{"btree", "skiplist"} {
+		t.Run(typ, func(t *testing.T) {
+			testBitcaskSnapshot(t, typ)
+		})
+	}
+}
+
+func testBitcaskSnapshot(t *testing.T, indexType string) {
+	dir, err := os.MkdirTemp("", "bitcask-snapshot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:       dir,
+		MaxFileSize:   1024,
+		IndexType:     indexType,
+		BlobThreshold: 100,
+		BlobFileSize:  1024,
+		BlobGCRatio:   0.1,
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	value := func(i int, tag string, size int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%s-%03d|", tag, i)), size)
+	}
+	for i := 0; i < 50; i++ {
+		db.Put(utils.GenerateKey(i), value(i, "v1", 2))
+	}
+	for i := 0; i < 10; i++ {
+		db.Put([]byte(fmt.Sprintf("blob-%d", i)), value(i, "blob", 20))
+	}
+	db.PutWithTTL([]byte("ttl"), []byte("value"), 20*time.Millisecond)
+
+	snap := db.Snapshot()
+	defer snap.Release()
+
+	check := func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			got, ok := snap.Get(utils.GenerateKey(i))
+			if !ok || !bytes.Equal(got, value(i, "v1", 2)) {
+				t.Fatalf("snapshot value mismatch for key %d: %s", i, got)
+			}
+		}
+		for i := 0; i < 10; i++ {
+			got, ok := snap.Get([]byte(fmt.Sprintf("blob-%d", i)))
+			if !ok || !bytes.Equal(got, value(i, "blob", 20)) {
+				t.Fatalf("snapshot blob mismatch for key %d", i)
+			}
+		}
+		if _, ok := snap.Get([]byte("new")); ok {
+			t.Fatal("key written after snapshot should not be visible")
+		}
+	}
+
+	t.Run("Writes", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				db.Del(utils.GenerateKey(i))
+			} else {
+				db.Put(utils.GenerateKey(i), value(i, "v2", 2))
+			}
+		}
+		for i := 0; i < 10; i++ {
+			db.Put([]byte(fmt.Sprintf("blob-%d", i)), value(i, "blob2", 20))
+		}
+		db.Put([]byte("new"), []byte("value"))
+		check(t)
+		if got, _ := db.Get(utils.GenerateKey(1)); !bytes.Equal(got, value(1, "v2", 2)) {
+			t.Fatalf("db should see the new value, got %s", got)
+		}
+	})
+
+	t.Run("Merge And Blob GC", func(t *testing.T) {
+		if err := db.Merge(); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		result, err := db.BlobGC()
+		if err != nil {
+			t.Fatalf("BlobGC failed: %v", err)
+		}
+		if result.Files == 0 {
+			t.Fatal("expected blob files to be collected")
+		}
+		check(t)
+		if len(db.retired) == 0 {
+			t.Fatal("merged files should be kept open for the snapshot")
+		}
+	})
+
+	t.Run("Expired After Snapshot", func(t *testing.T) {
+		// 快照按创建时间判断过期
+		time.Sleep(30 * time.Millisecond)
+		if _, ok := db.Get([]byte("ttl")); ok {
+			t.Fatal("ttl key should be expired in db")
+		}
+		if got, ok := snap.Get([]byte("ttl")); !ok || string(got) != "value" {
+			t.Fatalf("ttl key should be visible in snapshot, got %s", got)
+		}
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		it := snap.ScanPrefix([]byte("blob-"), ScanOptions{Reverse: true, Limit: 3})
+		defer it.Close()
+		keys := make([]string, 0)
+		for ; it.Valid(); it.Next() {
+			got, err := it.Value()
+			if err != nil || !bytes.Contains(got, []byte("blob-")) || bytes.Contains(got, []byte("blob2")) {
+				t.Fatalf("snapshot scan value mismatch: %s %v", got, err)
+			}
+			keys = append(keys, string(it.Key()))
+		}
+		if fmt.Sprint(keys) != "[blob-9 blob-8 blob-7]" {
+			t.Fatalf("snapshot scan mismatch: %v", keys)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		snap.Release()
+		snap.Release()
+		if len(db.retired) != 0 || len(db.pins) != 0 {
+			t.Fatalf("files should be released, retired=%d pins=%d", len(db.retired), len(db.pins))
+		}
+		if _, ok := snap.Get(utils.GenerateKey(1)); ok {
+			t.Fatal("released snapshot should not be readable")
+		}
+		if got, ok := db.Get(utils.GenerateKey(1)); !ok || !bytes.Equal(got, value(1, "v2", 2)) {
+			t.Fatalf("db value mismatch after release: %s", got)
+		}
+	})
+}
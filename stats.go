@@ -0,0 +1,119 @@
+package bitcask
+
+import (
+	"sort"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// FileStats 单个wal文件的空间使用情况
+type FileStats struct {
+	FileID     int64 // 文件id
+	TotalBytes int64 // 文件大小，包括文件头
+	LiveBytes  int64 // 仍被索引引用的记录大小
+	DeadBytes  int64 // 已被覆盖或删除的记录、墓碑和事务标记的大小，合并后可以回收
+	Tombstones int64 // 墓碑记录数
+}
+
+// Stats 存储的统计信息，已过期但还没有被合并的记录仍计入有效数据
+type Stats struct {
+	KeyCount     int         // 索引中的key数量
+	DataFiles    int         // wal文件数
+	TotalBytes   int64       // 所有wal文件的大小
+	LiveBytes    int64       // 有效记录的大小
+	DeadBytes    int64       // 可以回收的大小
+	Tombstones   int64       // 墓碑记录数
+	ActiveFileID int64       // 活跃文件id
+	ActiveOffset int64       // 活跃文件的写入位置
+	Files        []FileStats // 按文件id排序的每个文件的统计信息
+}
+
+// Stats 返回存储的统计信息，有效数据大小随写入增量维护，代价与文件数成正比
+func (b *Bitcask) Stats() Stats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := Stats{
+		KeyCount:     b.curIndex.Len(),
+		DataFiles:    len(b.olderWal) + 1,
+		ActiveFileID: b.fileId,
+		ActiveOffset: b.activeWal.GetOffset(),
+		Files:        make([]FileStats, 0, len(b.olderWal)+1),
+	}
+	for fileId := range b.olderWal {
+		stats.Files = append(stats.Files, b.fileStats(fileId))
+	}
+	stats.Files = append(stats.Files, b.fileStats(b.fileId))
+	sort.Slice(stats.Files, func(i, j int) bool {
+		return stats.Files[i].FileID < stats.Files[j].FileID
+	})
+	for _, f := range stats.Files {
+		stats.TotalBytes += f.TotalBytes
+		stats.LiveBytes += f.LiveBytes
+		stats.DeadBytes += f.DeadBytes
+		stats.Tombstones += f.Tombstones
+	}
+	return stats
+}
+
+// fileStats 计算单个wal文件的统计信息，调用方需持有读锁或写锁
+func (b *Bitcask) fileStats(fileId int64) FileStats {
+	w, _ := b.getWalFile(fileId)
+	live := b.liveBytes[fileId]
+	return FileStats{
+		FileID:     fileId,
+		TotalBytes: w.GetOffset(),
+		LiveBytes:  live,
+		DeadBytes:  w.GetOffset() - w.DataStart() - live,
+		Tombstones: w.Tombstones(),
+	}
+}
+
+// liveIndex 加载wal和hint文件时使用的索引，写入和删除经过indexPut和indexDelete，
+// 在应用记录的同时统计有效数据，不需要加载后再遍历一次索引
+type liveIndex struct {
+	index.Index
+	b *Bitcask
+}
+
+func (l liveIndex) Put(key []byte, pos *record.Pos) error {
+	return l.b.indexPut(key, pos)
+}
+
+func (l liveIndex) Delete(key []byte) error {
+	return l.b.indexDelete(key)
+}
+
+// indexPut 更新索引中key的位置，并把有效数据从旧位置所在文件移到新文件，调用方需持有写锁
+func (b *Bitcask) indexPut(key []byte, pos *record.Pos) error {
+	old, _ := b.curIndex.Get(key)
+	if err := b.curIndex.Put(key, pos); err != nil {
+		return err
+	}
+	b.moveLive(old, pos)
+	return nil
+}
+
+// indexDelete 从索引中删除key，并减少旧位置所在文件的有效数据，调用方需持有写锁
+func (b *Bitcask) indexDelete(key []byte) error {
+	old, _ := b.curIndex.Get(key)
+	if err := b.curIndex.Delete(key); err != nil {
+		return err
+	}
+	b.moveLive(old, nil)
+	return nil
+}
+
+// moveLive 将一条记录的有效数据从from所在文件移到to所在文件，nil表示没有对应的记录
+func (b *Bitcask) moveLive(from, to *record.Pos) {
+	if from != nil {
+		b.liveBytes[from.FileID] -= from.Size
+		if b.liveBytes[from.FileID] == 0 {
+			delete(b.liveBytes, from.FileID)
+		}
+	}
+	if to != nil {
+		b.liveBytes[to.FileID] += to.Size
+	}
+}
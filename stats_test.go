@@ -0,0 +1,139 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskStats(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-stats-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 1024,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	// 根据索引重新统计有效数据，与增量维护的结果比较
+	check := func(t *testing.T, stats Stats) {
+		live := make(map[int64]int64)
+		iter := db.curIndex.Iterator()
+		for ; iter.Valid(); iter.Next() {
+			live[iter.Value().FileID] += iter.Value().Size
+		}
+		iter.Close()
+		if stats.KeyCount != db.curIndex.Len() || stats.DataFiles != len(stats.Files) {
+			t.Fatalf("stats mismatch: %+v", stats)
+		}
+		var total int64
+		for _, f := range stats.Files {
+			if f.LiveBytes != live[f.FileID] {
+				t.Fatalf("live bytes mismatch for file %d: %d want %d", f.FileID, f.LiveBytes, live[f.FileID])
+			}
+			if f.DeadBytes < 0 || f.LiveBytes+f.DeadBytes > f.TotalBytes {
+				t.Fatalf("invalid file stats: %+v", f)
+			}
+			total += f.TotalBytes
+		}
+		if total != stats.TotalBytes || stats.LiveBytes+stats.DeadBytes > stats.TotalBytes {
+			t.Fatalf("total mismatch: %+v", stats)
+		}
+		last := stats.Files[len(stats.Files)-1]
+		if last.FileID != stats.ActiveFileID || last.TotalBytes != stats.ActiveOffset {
+			t.Fatalf("active file mismatch: %+v", stats)
+		}
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		stats := db.Stats()
+		check(t, stats)
+		if stats.KeyCount != 0 || stats.LiveBytes != 0 || stats.DeadBytes != 0 || stats.DataFiles != 1 {
+			t.Fatalf("unexpected stats for empty db: %+v", stats)
+		}
+	})
+
+	var before Stats
+	t.Run("Writes", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			db.Put(utils.GenerateKey(i), []byte(fmt.Sprintf("value-%d", i)))
+		}
+		if stats := db.Stats(); stats.DeadBytes != 0 || stats.KeyCount != 100 {
+			t.Fatalf("no dead bytes expected before overwrite: %+v", stats)
+		}
+		for i := 0; i < 50; i++ {
+			db.Put(utils.GenerateKey(i), []byte(fmt.Sprintf("value2-%d", i)))
+		}
+		for i := 50; i < 70; i++ {
+			db.Del(utils.GenerateKey(i))
+		}
+		batch := db.NewBatch()
+		batch.Delete(utils.GenerateKey(70))
+		batch.Put(utils.GenerateKey(71), []byte("batch"))
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+
+		before = db.Stats()
+		check(t, before)
+		if before.KeyCount != 79 || before.Tombstones != 21 || before.DeadBytes == 0 || before.DataFiles < 2 {
+			t.Fatalf("unexpected stats: %+v", before)
+		}
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		db.Close()
+		db, err = NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		stats := db.Stats()
+		check(t, stats)
+		if stats.LiveBytes != before.LiveBytes || stats.DeadBytes != before.DeadBytes || stats.Tombstones != before.Tombstones {
+			t.Fatalf("stats changed after reopen: %+v, want %+v", stats, before)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		if err := db.Merge(); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		stats := db.Stats()
+		check(t, stats)
+		if stats.LiveBytes != before.LiveBytes || stats.DeadBytes >= before.DeadBytes {
+			t.Fatalf("merge should only reclaim dead bytes: %+v, before %+v", stats, before)
+		}
+		for _, f := range stats.Files {
+			if f.FileID != stats.ActiveFileID && (f.DeadBytes != 0 || f.Tombstones != 0) {
+				t.Fatalf("merged file should not contain garbage: %+v", f)
+			}
+		}
+		before = stats
+	})
+
+	t.Run("Reopen After Merge", func(t *testing.T) {
+		db.Close()
+		db, err = NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		stats := db.Stats()
+		check(t, stats)
+		if stats.LiveBytes != before.LiveBytes || stats.DeadBytes != before.DeadBytes {
+			t.Fatalf("stats changed after reopen: %+v, want %+v", stats, before)
+		}
+	})
+}
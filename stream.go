@@ -0,0 +1,152 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+var ErrInvalidSize = errors.New("invalid value size")
+
+// PutReader 从r中读取size字节作为value写入，value直接写入数据文件，不需要完整读入内存。
+// 文件加密或value需要压缩时退化为读入内存后写入。写入期间持有写锁，r应当尽快返回数据
+func (b *Bitcask) PutReader(key []byte, r io.Reader, size int64) (err error) {
+	start := time.Now()
+	defer func() {
+		b.metrics.put.observe(start, err != nil)
+	}()
+	if err := b.checkKey(key); err != nil {
+		return err
+	}
+	if size < 0 {
+		return ErrInvalidSize
+	}
+	if err := b.checkValueSize(size); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	header := &record.Header{
+		Key:        key,
+		RecordType: record.RecordTypeNormal,
+		Seq:        b.seq.Add(1),
+		Timestamp:  time.Now().UnixNano(),
+	}
+
+	// 大value写入blob文件，wal中只写指针
+	separate := b.config.BlobThreshold > 0 && size >= b.config.BlobThreshold
+	target := b.activeWal
+	if separate {
+		blob, err := b.writableBlob()
+		if err != nil {
+			return err
+		}
+		target = blob
+	}
+
+	if !target.CanStream(size) {
+		value := make([]byte, size)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return fmt.Errorf("failed to read value: %v", err)
+		}
+		header.Value = value
+		separated, err := b.separateValue(header)
+		if err != nil {
+			return err
+		}
+		return b.appendIndexed(separated)
+	}
+
+	pos, err := target.AppendStream(header, r, size)
+	if err != nil {
+		return fmt.Errorf("failed to append record: %v", err)
+	}
+	if separate {
+		header.Value = encodeBlobPointer(pos)
+		header.Flags |= record.FlagBlob
+		return b.appendIndexed(header)
+	}
+	if err := b.indexPut(key, pos); err != nil {
+		return fmt.Errorf("failed to put key to index: %v", err)
+	}
+	if err := b.tryCreateNewWalFile(); err != nil {
+		return fmt.Errorf("failed to create new wal file: %v", err)
+	}
+	return nil
+}
+
+// GetReader 返回读取key对应value的流，读到末尾时校验crc，调用方需要关闭返回的流。
+// 返回后读取不持有锁，合并删除文件也不影响已打开的流。
+// 加密或压缩的记录先完整读入内存。与Get一样计入统计，延迟只包括打开流的时间
+func (b *Bitcask) GetReader(key []byte) (rc io.ReadCloser, err error) {
+	start := time.Now()
+	defer func() {
+		miss := errors.Is(err, ErrKeyNotFound)
+		b.metrics.get.observe(start, err != nil && !miss)
+		if miss {
+			b.metrics.getMisses.Add(1)
+		}
+	}()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	pos, err := b.curIndex.Get(key)
+	if errors.Is(err, index.ErrKeyNotFound) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	walFile, err := b.getWalFile(pos.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, rc, err := walFile.OpenValueReader(pos)
+	if err == nil {
+		if header.RecordType != record.RecordTypeNormal || header.IsExpired(time.Now().UnixNano()) {
+			rc.Close()
+			return nil, ErrKeyNotFound
+		}
+		return rc, nil
+	}
+	if !errors.Is(err, wal.ErrStreamUnsupported) {
+		return nil, err
+	}
+
+	header, err = walFile.ReadRecord(pos)
+	if err != nil {
+		return nil, err
+	}
+	if header.RecordType != record.RecordTypeNormal || header.IsExpired(time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	if header.Flags.Has(record.FlagBlob) {
+		if rc, err := b.openBlobReader(header); !errors.Is(err, wal.ErrStreamUnsupported) {
+			return rc, err
+		}
+		if err := b.resolveBlob(header); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(bytes.NewReader(header.Value)), nil
+}
+
+// openBlobReader 打开读取blob的流，调用方需持有读锁或写锁
+func (b *Bitcask) openBlobReader(header *record.Header) (io.ReadCloser, error) {
+	pos, err := decodeBlobPointer(header.Value)
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := b.blobs[pos.FileID]
+	if !ok {
+		return nil, fmt.Errorf("blob file %d not found", pos.FileID)
+	}
+	_, rc, err := blob.OpenValueReader(pos)
+	return rc, err
+}
@@ -0,0 +1,145 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xia-Sang/bitcask/compress"
+	"github.com/xia-Sang/bitcask/wal"
+)
+
+func TestBitcaskStream(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-stream-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 1024 * 1024,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), 200*1024)
+	readAll := func(key []byte) ([]byte, error) {
+		rc, err := db.GetReader(key)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	t.Run("Put And Get", func(t *testing.T) {
+		if err := db.PutReader([]byte("large"), bytes.NewReader(large), int64(len(large))); err != nil {
+			t.Fatalf("PutReader failed: %v", err)
+		}
+		value, err := readAll([]byte("large"))
+		if err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("GetReader mismatch: err=%v len=%d", err, len(value))
+		}
+		if value, ok := db.Get([]byte("large")); !ok || !bytes.Equal(value, large) {
+			t.Fatal("Get mismatch for streamed value")
+		}
+
+		// 普通写入的值也可以流式读取
+		db.Put([]byte("small"), []byte("value"))
+		if value, err := readAll([]byte("small")); err != nil || !bytes.Equal(value, []byte("value")) {
+			t.Fatalf("GetReader mismatch: %s %v", value, err)
+		}
+		if _, err := db.GetReader([]byte("missing")); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Short Reader", func(t *testing.T) {
+		err := db.PutReader([]byte("short"), bytes.NewReader(large[:100]), 200)
+		if err == nil {
+			t.Fatal("expected error for short reader")
+		}
+		if _, ok := db.Get([]byte("short")); ok {
+			t.Fatal("failed put should not be visible")
+		}
+
+		// 失败的写入被截断，不影响后续写入和恢复
+		if err := db.Put([]byte("after"), []byte("value")); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		db.Close()
+		reopened, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		db = reopened
+		if len(db.Recovery()) != 0 {
+			t.Fatalf("unexpected recovery report: %+v", db.Recovery())
+		}
+		if value, err := readAll([]byte("large")); err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("GetReader mismatch after reopen: %v", err)
+		}
+	})
+
+	t.Run("Crc Mismatch", func(t *testing.T) {
+		pos, err := db.curIndex.Get([]byte("large"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		walFile := filepath.Join(getWalDir(dir), getWalFileName(pos.FileID))
+		fp, err := os.OpenFile(walFile, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp.WriteAt([]byte("X"), pos.Offset+pos.Size/2)
+		fp.Close()
+
+		if _, err := readAll([]byte("large")); !errors.Is(err, wal.ErrCrcMismatch) {
+			t.Fatalf("expected ErrCrcMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Blob And Compression", func(t *testing.T) {
+		db.Close()
+		flate, err := compress.NewCompressor("flate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobConf := *conf
+		blobConf.BlobThreshold = 1024
+		blobConf.Compressor = flate
+		blobConf.CompressThreshold = 1024 * 1024
+		reopened, err := NewBitcask(&blobConf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		db = reopened
+
+		// 小于压缩阈值的value流式写入blob文件
+		value := large[:512*1024]
+		if err := db.PutReader([]byte("blob"), bytes.NewReader(value), int64(len(value))); err != nil {
+			t.Fatalf("PutReader failed: %v", err)
+		}
+		if got, err := readAll([]byte("blob")); err != nil || !bytes.Equal(got, value) {
+			t.Fatalf("GetReader mismatch for blob: %v", err)
+		}
+
+		// 需要压缩的value读入内存后写入
+		if err := db.PutReader([]byte("compressed"), bytes.NewReader(large), int64(len(large))); err != nil {
+			t.Fatalf("PutReader failed: %v", err)
+		}
+		if got, err := readAll([]byte("compressed")); err != nil || !bytes.Equal(got, large) {
+			t.Fatalf("GetReader mismatch for compressed value: %v", err)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package bitcask
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrInvalidTTL  = errors.New("ttl must be positive")
+)
+
+// PutWithTTL 写入键值对，ttl之后过期
+func (b *Bitcask) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return b.put(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// Expire 为已存在的key设置新的过期时间，key不存在或已过期时返回ErrKeyNotFound
+func (b *Bitcask) Expire(key []byte, ttl time.Duration) (err error) {
+	start := time.Now()
+	defer func() {
+		// 重写记录计入put，key不存在时没有写入
+		if !errors.Is(err, ErrKeyNotFound) {
+			b.metrics.put.observe(start, err != nil)
+		}
+	}()
+	if err := b.checkKey(key); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pos, err := b.curIndex.Get(key)
+	if err != nil {
+		return ErrKeyNotFound
+	}
+	header, ok := b.readRecord(pos)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	header.ExpireAt = time.Now().Add(ttl).UnixNano()
+	return b.appendRecord(header)
+}
@@ -0,0 +1,97 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/xia-Sang/bitcask/utils"
+)
+
+func TestBitcaskTTL(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-ttl-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 256,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	if err := db.PutWithTTL([]byte("short"), []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if err := db.PutWithTTL([]byte("long"), []byte("value"), time.Hour); err != nil {
+		t.Fatalf("PutWithTTL failed: %v", err)
+	}
+	if err := db.Put([]byte("expire"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Expire([]byte("expire"), 50*time.Millisecond); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	if err := db.PutWithTTL([]byte("key"), []byte("value"), 0); !errors.Is(err, ErrInvalidTTL) {
+		t.Fatalf("expected ErrInvalidTTL, got %v", err)
+	}
+	if err := db.Expire([]byte("missing"), time.Second); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	for _, key := range []string{"short", "long", "expire"} {
+		if value, ok := db.Get([]byte(key)); !ok || !bytes.Equal(value, []byte("value")) {
+			t.Fatalf("key %s should exist before expiration", key)
+		}
+	}
+
+	// 写入更多数据，让带过期时间的记录进入已封存文件
+	for i := 0; i < 30; i++ {
+		if err := db.Put(utils.GenerateKey(i), utils.GenerateValue(10)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	check := func(db *Bitcask) {
+		for _, key := range []string{"short", "expire"} {
+			if _, ok := db.Get([]byte(key)); ok {
+				t.Fatalf("key %s should be expired", key)
+			}
+			if err := db.Expire([]byte(key), time.Second); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("expected ErrKeyNotFound for expired key, got %v", err)
+			}
+		}
+		if _, ok := db.Get([]byte("long")); !ok {
+			t.Fatal("key long should not be expired")
+		}
+	}
+	check(db)
+
+	// 合并会丢弃过期的记录
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	check(db)
+
+	// 重启后过期的记录不会加载到索引中
+	db.Close()
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to reopen bitcask: %v", err)
+	}
+	check(db)
+	if _, err := db.curIndex.Get([]byte("short")); err == nil {
+		t.Fatal("expired key should not be loaded into index")
+	}
+}
@@ -0,0 +1,192 @@
+package bitcask
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var (
+	ErrTxnConflict = errors.New("transaction conflict")
+	ErrTxnReadOnly = errors.New("transaction is read-only")
+	ErrTxnClosed   = errors.New("transaction is closed")
+)
+
+// conflictSeq 读取记录失败时使用的序列号，与任何记录都不相同，提交时一定冲突
+const conflictSeq = math.MaxUint64
+
+// txnRead 事务读取key时的版本
+type txnRead struct {
+	exists bool   // 读取时索引中是否存在
+	seq    uint64 // 读取时记录的序列号
+}
+
+// Txn 读写事务，写入在提交前只保存在内存中，
+// 提交时检查读取过的key是否被其他写入修改过（乐观并发控制）。
+// 合并会复用文件id，同一位置先后可能保存不同的记录，所以按记录的序列号判断是否被修改
+type Txn struct {
+	db       *Bitcask
+	mu       sync.Mutex
+	writable bool                      // 是否可写
+	reads    map[string]txnRead        // 读取过的key及读取时的版本
+	writes   map[string]*record.Header // 待写入的记录
+	order    []string                  // 写入顺序
+	closed   bool                      // 是否已提交或回滚
+}
+
+// Begin 开启一个事务
+func (b *Bitcask) Begin(writable bool) *Txn {
+	return &Txn{
+		db:       b,
+		writable: writable,
+		reads:    make(map[string]txnRead),
+		writes:   make(map[string]*record.Header),
+		order:    make([]string, 0),
+	}
+}
+
+// Update 在读写事务中执行fn，fn返回错误时回滚，否则提交；
+// 提交时发生冲突返回ErrTxnConflict，调用方可以重试
+func (b *Bitcask) Update(fn func(tx *Txn) error) error {
+	tx := b.Begin(true)
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// View 在只读事务中执行fn
+func (b *Bitcask) View(fn func(tx *Txn) error) error {
+	tx := b.Begin(false)
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// Get 读取key，优先返回事务内的写入
+func (tx *Txn) Get(key []byte) ([]byte, bool) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return nil, false
+	}
+	if w, ok := tx.writes[string(key)]; ok {
+		if w.RecordType == record.RecordTypeDeleted {
+			return nil, false
+		}
+		return w.Value, true
+	}
+
+	db := tx.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	pos, err := db.curIndex.Get(key)
+	if err != nil {
+		pos = nil
+	}
+	if _, ok := tx.reads[string(key)]; !ok {
+		tx.reads[string(key)] = db.readVersion(pos)
+	}
+	return db.readValue(pos)
+}
+
+// Put 在事务中写入键值对
+func (tx *Txn) Put(key []byte, value []byte) error {
+	if err := tx.db.checkKey(key); err != nil {
+		return err
+	}
+	if err := tx.db.checkValue(value); err != nil {
+		return err
+	}
+	return tx.write(key, value, record.RecordTypeNormal)
+}
+
+// Delete 在事务中删除key
+func (tx *Txn) Delete(key []byte) error {
+	if err := tx.db.checkKey(key); err != nil {
+		return err
+	}
+	return tx.write(key, nil, record.RecordTypeDeleted)
+}
+
+func (tx *Txn) write(key []byte, value []byte, typ record.RecordType) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return ErrTxnClosed
+	}
+	if !tx.writable {
+		return ErrTxnReadOnly
+	}
+	if _, ok := tx.writes[string(key)]; !ok {
+		tx.order = append(tx.order, string(key))
+	}
+	tx.writes[string(key)] = &record.Header{
+		Key:        append([]byte(nil), key...),
+		Value:      append([]byte(nil), value...),
+		RecordType: typ,
+	}
+	return nil
+}
+
+// Commit 提交事务，读取过的key在提交前被修改时返回ErrTxnConflict
+func (tx *Txn) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.closed {
+		return ErrTxnClosed
+	}
+	tx.closed = true
+	if !tx.writable || len(tx.order) == 0 {
+		return nil
+	}
+
+	db := tx.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 校验读集合
+	for key, read := range tx.reads {
+		curPos, err := db.curIndex.Get([]byte(key))
+		if err != nil {
+			curPos = nil
+		}
+		if db.readVersion(curPos) != read {
+			return ErrTxnConflict
+		}
+	}
+
+	records := make([]*record.Header, 0, len(tx.order))
+	for _, key := range tx.order {
+		records = append(records, tx.writes[key])
+	}
+	return db.writeBatch(records)
+}
+
+// Rollback 回滚事务，丢弃所有写入
+func (tx *Txn) Rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.closed = true
+	tx.reads = nil
+	tx.writes = nil
+	tx.order = nil
+}
+
+// readVersion 读取位置信息对应记录的版本，调用方需持有读锁或写锁
+func (b *Bitcask) readVersion(pos *record.Pos) txnRead {
+	if pos == nil {
+		return txnRead{}
+	}
+	walFile, err := b.getWalFile(pos.FileID)
+	if err != nil {
+		return txnRead{exists: true, seq: conflictSeq}
+	}
+	header, err := walFile.ReadRecord(pos)
+	if err != nil {
+		return txnRead{exists: true, seq: conflictSeq}
+	}
+	return txnRead{exists: true, seq: header.Seq}
+}
@@ -0,0 +1,181 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-txn-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Config{
+		DirPath:     dir,
+		MaxFileSize: 512,
+		IndexType:   "btree",
+	}
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer func() {
+		db.Close()
+	}()
+
+	t.Run("Commit", func(t *testing.T) {
+		err := db.Update(func(tx *Txn) error {
+			if err := tx.Put([]byte("a"), []byte("1")); err != nil {
+				return err
+			}
+			// 读取事务内的写入
+			value, ok := tx.Get([]byte("a"))
+			if !ok || !bytes.Equal(value, []byte("1")) {
+				t.Errorf("read your own writes failed, got %s", value)
+			}
+			if _, ok := db.Get([]byte("a")); ok {
+				t.Error("write should not be visible before commit")
+			}
+			return tx.Put([]byte("b"), []byte("2"))
+		})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if value, ok := db.Get([]byte("b")); !ok || !bytes.Equal(value, []byte("2")) {
+			t.Fatalf("committed value mismatch, got %s", value)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		errAbort := errors.New("abort")
+		err := db.Update(func(tx *Txn) error {
+			if err := tx.Put([]byte("c"), []byte("3")); err != nil {
+				return err
+			}
+			if err := tx.Delete([]byte("a")); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("expected errAbort, got %v", err)
+		}
+		if _, ok := db.Get([]byte("c")); ok {
+			t.Error("rolled back write should not be visible")
+		}
+		if _, ok := db.Get([]byte("a")); !ok {
+			t.Error("rolled back delete should not take effect")
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		tx := db.Begin(true)
+		value, ok := tx.Get([]byte("a"))
+		if !ok {
+			t.Fatal("failed to get key in txn")
+		}
+		if err := tx.Put([]byte("a"), append(value, '!')); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+
+		// 其他写入修改了事务读取过的key
+		if err := db.Put([]byte("a"), []byte("changed")); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxnConflict) {
+			t.Fatalf("expected ErrTxnConflict, got %v", err)
+		}
+		if value, _ := db.Get([]byte("a")); !bytes.Equal(value, []byte("changed")) {
+			t.Fatalf("conflicting txn should not be applied, got %s", value)
+		}
+
+		// 读取时不存在的key被其他写入创建
+		tx = db.Begin(true)
+		if _, ok := tx.Get([]byte("d")); ok {
+			t.Fatal("key d should not exist")
+		}
+		tx.Put([]byte("e"), []byte("5"))
+		db.Put([]byte("d"), []byte("4"))
+		if err := tx.Commit(); !errors.Is(err, ErrTxnConflict) {
+			t.Fatalf("expected ErrTxnConflict, got %v", err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxnClosed) {
+			t.Fatalf("expected ErrTxnClosed, got %v", err)
+		}
+	})
+
+	t.Run("View", func(t *testing.T) {
+		err := db.View(func(tx *Txn) error {
+			if _, ok := tx.Get([]byte("b")); !ok {
+				t.Error("failed to get key in view")
+			}
+			return tx.Put([]byte("f"), []byte("6"))
+		})
+		if !errors.Is(err, ErrTxnReadOnly) {
+			t.Fatalf("expected ErrTxnReadOnly, got %v", err)
+		}
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		db.Close()
+		reopened, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("failed to reopen bitcask: %v", err)
+		}
+		db = reopened
+		if value, ok := db.Get([]byte("b")); !ok || !bytes.Equal(value, []byte("2")) {
+			t.Fatalf("committed value mismatch after reopen, got %s", value)
+		}
+		if _, ok := db.Get([]byte("e")); ok {
+			t.Fatal("conflicting txn should not be persisted")
+		}
+	})
+}
+
+func TestTxnConflictAfterMerge(t *testing.T) {
+	dir, err := os.MkdirTemp("", "bitcask-txn-merge-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 每个文件只能写入一条记录
+	db, err := NewBitcask(&Config{
+		DirPath:     dir,
+		MaxFileSize: 72,
+		IndexType:   "btree",
+	})
+	if err != nil {
+		t.Fatalf("failed to create bitcask: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("k"), []byte("v1"))
+	tx := db.Begin(true)
+	if value, ok := tx.Get([]byte("k")); !ok || string(value) != "v1" {
+		t.Fatalf("txn read mismatch: %s", value)
+	}
+	readPos, _ := db.curIndex.Get([]byte("k"))
+
+	// 其他写入修改k后合并，新记录被搬到与事务读取时相同的位置
+	db.Put([]byte("k"), []byte("v2"))
+	db.Put([]byte("other"), []byte("x"))
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if curPos, _ := db.curIndex.Get([]byte("k")); !samePos(curPos, readPos) {
+		t.Fatalf("merge should reuse the read position: %+v %+v", curPos, readPos)
+	}
+
+	tx.Put([]byte("k"), []byte("v1+txn"))
+	if err := tx.Commit(); !errors.Is(err, ErrTxnConflict) {
+		t.Fatalf("expected ErrTxnConflict, got %v", err)
+	}
+	if value, _ := db.Get([]byte("k")); string(value) != "v2" {
+		t.Fatalf("conflicting txn should not be applied, got %s", value)
+	}
+}
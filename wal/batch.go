@@ -0,0 +1,94 @@
+package wal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+// AppendBatch 以事务开始和提交记录包裹一组记录，一次性写入文件，
+// 返回每条记录的位置信息
+func (w *WAL) AppendBatch(batchId []byte, records []*record.Header) ([]*record.Pos, error) {
+	for _, r := range records {
+		if err := checkRecordSize(int64(len(r.Key)), int64(len(r.Value))); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按文件的格式版本序列化整个事务，事务中的记录使用相同的时间戳
+	version := w.Version()
+	now := time.Now().UnixNano()
+	begin := (&record.Header{Key: batchId, RecordType: record.RecordTypeTransactionBegin, Timestamp: now}).Encode(version)
+	commit := (&record.Header{Key: batchId, RecordType: record.RecordTypeTransactionCommit, Timestamp: now}).Encode(version)
+	encoded := make([][]byte, 0, len(records))
+	size := len(begin) + len(commit)
+	for _, r := range records {
+		if r.Timestamp == 0 {
+			r.Timestamp = now
+		}
+		data, err := w.encodeRecord(r, version)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, data)
+		size += len(data)
+	}
+
+	// 获取写入前的偏移量
+	startOffset := w.fileIO.GetOffset()
+
+	// 加密文件中每条记录单独加密，认证数据使用记录的偏移量
+	if w.aead != nil {
+		offset := startOffset
+		var err error
+		if begin, err = w.seal(begin, offset); err != nil {
+			return nil, err
+		}
+		offset += int64(len(begin))
+		for i, data := range encoded {
+			if encoded[i], err = w.seal(data, offset); err != nil {
+				return nil, err
+			}
+			offset += int64(len(encoded[i]))
+		}
+		if commit, err = w.seal(commit, offset); err != nil {
+			return nil, err
+		}
+		size += (len(encoded) + 2) * sealedLength(0)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, begin...)
+	for _, data := range encoded {
+		buf = append(buf, data...)
+	}
+	buf = append(buf, commit...)
+
+	// 写入数据
+	n, err := w.fileIO.Write(buf)
+	if err != nil {
+		return nil, fmt.Errorf("write error: %v", err)
+	}
+	if err := w.maybeSync(n); err != nil {
+		return nil, err
+	}
+
+	// 计算每条记录的位置信息
+	positions := make([]*record.Pos, 0, len(records))
+	offset := startOffset + int64(len(begin))
+	for i, r := range records {
+		pos := &record.Pos{
+			FileID: w.fileIO.GetFileID(),
+			Offset: offset,
+			Size:   int64(len(encoded[i])),
+		}
+		positions = append(positions, pos)
+		if r.Seq > w.maxSeq {
+			w.maxSeq = r.Seq
+		}
+		w.countTombstone(r.RecordType)
+		w.addHint(r.Key, r.RecordType, r.ExpireAt, pos)
+		offset += pos.Size
+	}
+	return positions, nil
+}
@@ -0,0 +1,71 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xia-Sang/bitcask/compress"
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var ErrDecompress = errors.New("failed to decompress value")
+
+// encodeRecord 按文件的格式版本序列化记录，value长度达到阈值时先压缩，
+// 压缩后的value以压缩算法id开头
+func (w *WAL) encodeRecord(header *record.Header, version uint16) ([]byte, error) {
+	c := w.options.Compressor
+	if c == nil || version == record.FormatV0 || header.RecordType != record.RecordTypeNormal ||
+		len(header.Value) == 0 || int64(len(header.Value)) < w.options.CompressThreshold {
+		return header.Encode(version), nil
+	}
+	compressed, err := c.Compress(header.Value)
+	if err != nil {
+		return nil, fmt.Errorf("compress value error: %v", err)
+	}
+	// 压缩后没有变小时保存原始数据
+	if len(compressed)+1 >= len(header.Value) {
+		return header.Encode(version), nil
+	}
+
+	value := make([]byte, 0, len(compressed)+1)
+	value = append(value, c.ID())
+	value = append(value, compressed...)
+	encoded := *header
+	encoded.Value = value
+	encoded.Flags |= record.FlagCompressed
+	return encoded.Encode(version), nil
+}
+
+// decompress 解压记录中的value并清除压缩标志，
+// 记录已通过校验，解压失败说明缺少对应的压缩算法或解压后超出长度上限，不视为记录损坏
+func (w *WAL) decompress(header *record.Header) error {
+	if !header.Flags.Has(record.FlagCompressed) {
+		return nil
+	}
+	if len(header.Value) == 0 {
+		return fmt.Errorf("%w: missing compressor id", ErrDecompress)
+	}
+	c, err := w.compressor(header.Value[0])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecompress, err)
+	}
+	limit := w.options.MaxValueLength
+	if limit <= 0 {
+		limit = record.MaxValueSize
+	}
+	value, err := c.Decompress(header.Value[1:], limit)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecompress, err)
+	}
+	header.Value = value
+	header.Flags &^= record.FlagCompressed
+	return nil
+}
+
+// compressor 根据id查找压缩算法，优先使用配置的算法
+func (w *WAL) compressor(id byte) (compress.Compressor, error) {
+	if c := w.options.Compressor; c != nil && c.ID() == id {
+		return c, nil
+	}
+	return compress.Lookup(id)
+}
@@ -0,0 +1,141 @@
+package wal
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xia-Sang/bitcask/encrypt"
+)
+
+var (
+	ErrDecrypt  = errors.New("failed to decrypt record")
+	ErrWrongKey = errors.New("encryption key does not match file")
+)
+
+// nonceReader 生成nonce的随机数来源，测试时可以替换
+var nonceReader io.Reader = rand.Reader
+
+// 加密记录格式:
+// length(4) nonce(12) ciphertext，ciphertext为明文记录加密后的数据，包含16字节认证标签
+const (
+	envelopeHeaderLength = 4
+	nonceLength          = 12
+	tagLength            = 16
+	keyCheckLength       = nonceLength + tagLength // 加密的空数据，用于校验密钥
+)
+
+// newCipher 使用当前密钥为新文件创建加密器，返回写在文件头之后的密钥校验块
+func (w *WAL) newCipher() ([]byte, error) {
+	id, key, err := w.options.Keys.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current key: %v", err)
+	}
+	aead, err := encrypt.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	w.aead = aead
+	w.header.Flags |= FileFlagEncrypted
+	w.header.KeyID = id
+	keyCheck, err := w.seal(nil, FileHeaderLength)
+	if err != nil {
+		return nil, err
+	}
+	return keyCheck[envelopeHeaderLength:], nil
+}
+
+// openCipher 根据文件头中的密钥id创建加密器，并用密钥校验块确认密钥正确
+func (w *WAL) openCipher() error {
+	if w.options.Keys == nil {
+		return fmt.Errorf("%w: file %d is encrypted", encrypt.ErrKeyNotFound, w.GetFileID())
+	}
+	key, err := w.options.Keys.Key(w.header.KeyID)
+	if err != nil {
+		return err
+	}
+	aead, err := encrypt.NewAEAD(key)
+	if err != nil {
+		return err
+	}
+	keyCheck, err := w.fileIO.ReadAt(FileHeaderLength, keyCheckLength)
+	if err != nil {
+		return fmt.Errorf("failed to read key check: %v", err)
+	}
+	w.aead = aead
+	if _, err := w.open(keyCheck, FileHeaderLength); err != nil {
+		return fmt.Errorf("%w: file %d key id %d", ErrWrongKey, w.GetFileID(), w.header.KeyID)
+	}
+	w.dataStart = FileHeaderLength + keyCheckLength
+	return nil
+}
+
+// Encrypted 文件是否加密
+func (w *WAL) Encrypted() bool {
+	return w.aead != nil
+}
+
+// additionalData 认证数据，将密文绑定到文件和偏移量上
+func (w *WAL) additionalData(offset int64) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(w.header.CreatedAt))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(offset))
+	return buf
+}
+
+// seal 加密写入offset处的数据
+func (w *WAL) seal(data []byte, offset int64) ([]byte, error) {
+	buf := make([]byte, envelopeHeaderLength+nonceLength, sealedLength(len(data)))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(nonceLength+len(data)+tagLength))
+	if _, err := io.ReadFull(nonceReader, buf[envelopeHeaderLength:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	nonce := buf[envelopeHeaderLength:]
+	return w.aead.Seal(buf, nonce, data, w.additionalData(offset)), nil
+}
+
+// open 解密offset处的数据，data不包含长度字段
+func (w *WAL) open(data []byte, offset int64) ([]byte, error) {
+	if len(data) < nonceLength+tagLength {
+		return nil, ErrDecrypt
+	}
+	plain, err := w.aead.Open(nil, data[:nonceLength], data[nonceLength:], w.additionalData(offset))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// sealedLength 加密后的记录长度
+func sealedLength(n int) int {
+	return envelopeHeaderLength + nonceLength + n + tagLength
+}
+
+// readSealed 读取并解密offset处的加密记录，返回明文记录和加密记录的长度
+func (w *WAL) readSealed(offset int64, fileSize int64) ([]byte, int64, error) {
+	if offset+envelopeHeaderLength > fileSize {
+		return nil, 0, w.corrupted(offset, fileSize, io.ErrUnexpectedEOF)
+	}
+	lengthBytes, err := w.ReadAt(offset, envelopeHeaderLength)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read at error: %v", err)
+	}
+	length := int64(binary.BigEndian.Uint32(lengthBytes))
+	if length < nonceLength+tagLength {
+		return nil, 0, w.corrupted(offset, fileSize, fmt.Errorf("%w: sealed length %d", ErrInvalidRecordSize, length))
+	}
+	if offset+envelopeHeaderLength+length > fileSize {
+		return nil, 0, w.corrupted(offset, fileSize, io.ErrUnexpectedEOF)
+	}
+	data, err := w.ReadAt(offset+envelopeHeaderLength, length)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read at error: %v", err)
+	}
+	plain, err := w.open(data, offset)
+	if err != nil {
+		return nil, 0, w.corrupted(offset, fileSize, err)
+	}
+	return plain, envelopeHeaderLength + length, nil
+}
@@ -0,0 +1,143 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var (
+	ErrInvalidFileHeader  = errors.New("invalid file header")
+	ErrUnsupportedVersion = errors.New("unsupported file format version")
+)
+
+// 文件头格式:
+// magic(4) version(2) flags(4) createdAt(8) baseSeq(8) keyId(2) crc32(4)
+const FileHeaderLength = 32
+
+// 文件标志位
+const (
+	FileFlagEncrypted uint32 = 1 << iota // 记录使用AES-GCM加密
+)
+
+var fileMagic = []byte("BCSK")
+
+// FileHeader wal文件头，v0格式的文件没有文件头
+type FileHeader struct {
+	Version   uint16 // 格式版本
+	Flags     uint32 // 文件标志位
+	CreatedAt int64  // 创建时间(UnixNano)
+	BaseSeq   uint64 // 创建文件时已分配的最大序列号
+	KeyID     uint16 // 加密密钥id，只在设置了FileFlagEncrypted时有效
+}
+
+// encode 序列化文件头
+func (h *FileHeader) encode() []byte {
+	buf := make([]byte, FileHeaderLength)
+	copy(buf[0:4], fileMagic)
+	binary.BigEndian.PutUint16(buf[4:6], h.Version)
+	binary.BigEndian.PutUint32(buf[6:10], h.Flags)
+	binary.BigEndian.PutUint64(buf[10:18], uint64(h.CreatedAt))
+	binary.BigEndian.PutUint64(buf[18:26], h.BaseSeq)
+	binary.BigEndian.PutUint16(buf[26:28], h.KeyID)
+	binary.BigEndian.PutUint32(buf[FileHeaderLength-4:], crc32.ChecksumIEEE(buf[:FileHeaderLength-4]))
+	return buf
+}
+
+// decodeFileHeader 反序列化文件头
+func decodeFileHeader(buf []byte) (*FileHeader, error) {
+	if len(buf) < FileHeaderLength || !bytes.Equal(buf[0:4], fileMagic) {
+		return nil, ErrInvalidFileHeader
+	}
+	if binary.BigEndian.Uint32(buf[FileHeaderLength-4:]) != crc32.ChecksumIEEE(buf[:FileHeaderLength-4]) {
+		return nil, ErrInvalidFileHeader
+	}
+	header := &FileHeader{
+		Version:   binary.BigEndian.Uint16(buf[4:6]),
+		Flags:     binary.BigEndian.Uint32(buf[6:10]),
+		CreatedAt: int64(binary.BigEndian.Uint64(buf[10:18])),
+		BaseSeq:   binary.BigEndian.Uint64(buf[18:26]),
+		KeyID:     binary.BigEndian.Uint16(buf[26:28]),
+	}
+	if header.Version == record.FormatV0 || header.Version > record.FormatCurrent {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header.Version)
+	}
+	return header, nil
+}
+
+// initHeader 新文件写入文件头，已有文件读取文件头，
+// 没有魔数的文件按v0格式处理
+func (w *WAL) initHeader() error {
+	size, err := w.fileIO.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get file size: %v", err)
+	}
+
+	if size > 0 {
+		buf, err := w.fileIO.ReadAt(0, min(size, FileHeaderLength))
+		if err != nil {
+			return fmt.Errorf("failed to read file header: %v", err)
+		}
+		n := min(len(buf), len(fileMagic))
+		if !bytes.Equal(buf[:n], fileMagic[:n]) {
+			w.header = FileHeader{Version: record.FormatV0}
+			w.dataStart = 0
+			return nil
+		}
+		if size >= FileHeaderLength {
+			header, err := decodeFileHeader(buf)
+			if err != nil {
+				return err
+			}
+			w.header = *header
+			w.dataStart = FileHeaderLength
+			if header.Flags&FileFlagEncrypted == 0 {
+				return nil
+			}
+			if size >= FileHeaderLength+keyCheckLength {
+				return w.openCipher()
+			}
+		}
+		// 文件头写了一半，文件中还没有记录，重新写入文件头
+		if err := w.fileIO.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate file: %v", err)
+		}
+	}
+
+	w.header = FileHeader{
+		Version:   record.FormatCurrent,
+		CreatedAt: time.Now().UnixNano(),
+		BaseSeq:   w.options.BaseSeq,
+	}
+	// 加密文件在文件头之后写入密钥校验块
+	var keyCheck []byte
+	if w.options.Keys != nil {
+		if keyCheck, err = w.newCipher(); err != nil {
+			return err
+		}
+	}
+	data := append(w.header.encode(), keyCheck...)
+	if _, err := w.fileIO.Write(data); err != nil {
+		return fmt.Errorf("failed to write file header: %v", err)
+	}
+	if err := w.fileIO.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file header: %v", err)
+	}
+	w.dataStart = int64(len(data))
+	return nil
+}
+
+// Header 返回文件头
+func (w *WAL) Header() FileHeader {
+	return w.header
+}
+
+// Version 返回文件的格式版本
+func (w *WAL) Version() uint16 {
+	return w.header.Version
+}
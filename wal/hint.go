@@ -0,0 +1,201 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"github.com/xia-Sang/bitcask/index"
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var ErrHintCorrupted = errors.New("hint file is corrupted")
+
+// hint文件格式:
+// dataSize(8) | entry... | crc32(4)
+// entry: recordType(1) keySize(4) offset(8) size(8) [expireAt(8)] key
+// 加密文件的hint文件整体加密，格式与加密记录相同
+const (
+	hintFileHeaderLength  = 8
+	hintEntryHeaderLength = 1 + 4 + 8 + 8
+	hintSealOffset        = -1 // hint文件加密时认证数据使用的偏移量
+)
+
+// HintEntry hint文件中的一条记录，只保存key和记录位置
+type HintEntry struct {
+	Key        []byte            // 键
+	RecordType record.RecordType // 记录类型
+	Offset     int64             // 偏移量
+	Size       int64             // 大小
+	ExpireAt   int64             // 过期时间，0表示永不过期
+}
+
+// addHint 记录一条hint
+func (w *WAL) addHint(key []byte, typ record.RecordType, expireAt int64, pos *record.Pos) {
+	if w.options.DisableHint {
+		return
+	}
+	w.hints = append(w.hints, HintEntry{
+		Key:        append([]byte(nil), key...),
+		RecordType: typ,
+		Offset:     pos.Offset,
+		Size:       pos.Size,
+		ExpireAt:   expireAt,
+	})
+}
+
+// encodedLength hint记录编码后的长度
+func (e *HintEntry) encodedLength() int {
+	n := hintEntryHeaderLength + len(e.Key)
+	if record.RecordType(record.EncodeType(e.RecordType, e.ExpireAt)) == record.RecordTypeExpiring {
+		n += record.ExpireAtLength
+	}
+	return n
+}
+
+// WriteHint 将当前文件的hint写入指定路径，写入成功后清空内存中的hint
+func (w *WAL) WriteHint(hintPath string) error {
+	size := hintFileHeaderLength + 4
+	for _, entry := range w.hints {
+		size += entry.encodedLength()
+	}
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint64(buf[0:8], uint64(w.GetOffset()))
+	n := hintFileHeaderLength
+	for _, entry := range w.hints {
+		buf[n] = record.EncodeType(entry.RecordType, entry.ExpireAt)
+		binary.BigEndian.PutUint32(buf[n+1:n+5], uint32(len(entry.Key)))
+		binary.BigEndian.PutUint64(buf[n+5:n+13], uint64(entry.Offset))
+		binary.BigEndian.PutUint64(buf[n+13:n+21], uint64(entry.Size))
+		keyOffset := n + hintEntryHeaderLength
+		if record.RecordType(buf[n]) == record.RecordTypeExpiring {
+			binary.BigEndian.PutUint64(buf[keyOffset:keyOffset+record.ExpireAtLength], uint64(entry.ExpireAt))
+			keyOffset += record.ExpireAtLength
+		}
+		copy(buf[keyOffset:], entry.Key)
+		n += entry.encodedLength()
+	}
+	binary.BigEndian.PutUint32(buf[n:], crc32.ChecksumIEEE(buf[:n]))
+	if w.aead != nil {
+		var err error
+		if buf, err = w.seal(buf, hintSealOffset); err != nil {
+			return err
+		}
+	}
+
+	// 先写临时文件再重命名，避免留下写了一半的hint文件
+	tmpPath := hintPath + ".tmp"
+	fp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create hint file: %v", err)
+	}
+	if _, err := fp.Write(buf); err != nil {
+		fp.Close()
+		return fmt.Errorf("failed to write hint file: %v", err)
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return fmt.Errorf("failed to sync hint file: %v", err)
+	}
+	if err := fp.Close(); err != nil {
+		return fmt.Errorf("failed to close hint file: %v", err)
+	}
+	if err := os.Rename(tmpPath, hintPath); err != nil {
+		return fmt.Errorf("failed to rename hint file: %v", err)
+	}
+	w.hints = nil
+	return nil
+}
+
+// DiscardHint 清空内存中的hint
+func (w *WAL) DiscardHint() {
+	w.hints = nil
+}
+
+// ReadHint 读取并校验hint文件，dataSize与hint记录的数据文件大小不一致时视为损坏
+func ReadHint(hintPath string, dataSize int64) ([]HintEntry, error) {
+	buf, err := os.ReadFile(hintPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseHint(buf, dataSize)
+}
+
+// parseHint 解析hint文件内容
+func parseHint(buf []byte, dataSize int64) ([]HintEntry, error) {
+	if len(buf) < hintFileHeaderLength+4 {
+		return nil, ErrHintCorrupted
+	}
+	n := len(buf) - 4
+	if binary.BigEndian.Uint32(buf[n:]) != crc32.ChecksumIEEE(buf[:n]) {
+		return nil, ErrHintCorrupted
+	}
+	if int64(binary.BigEndian.Uint64(buf[0:8])) != dataSize {
+		return nil, ErrHintCorrupted
+	}
+
+	entries := make([]HintEntry, 0)
+	offset := hintFileHeaderLength
+	for offset < n {
+		if offset+hintEntryHeaderLength > n {
+			return nil, ErrHintCorrupted
+		}
+		recordType, hasExpire := record.DecodeType(buf[offset])
+		keySize := int(binary.BigEndian.Uint32(buf[offset+1 : offset+5]))
+		keyOffset := offset + hintEntryHeaderLength
+		var expireAt int64
+		if hasExpire {
+			if keyOffset+record.ExpireAtLength > n {
+				return nil, ErrHintCorrupted
+			}
+			expireAt = int64(binary.BigEndian.Uint64(buf[keyOffset : keyOffset+record.ExpireAtLength]))
+			keyOffset += record.ExpireAtLength
+		}
+		if keyOffset+keySize > n {
+			return nil, ErrHintCorrupted
+		}
+		entries = append(entries, HintEntry{
+			RecordType: recordType,
+			Offset:     int64(binary.BigEndian.Uint64(buf[offset+5 : offset+13])),
+			Size:       int64(binary.BigEndian.Uint64(buf[offset+13 : offset+21])),
+			ExpireAt:   expireAt,
+			Key:        buf[keyOffset : keyOffset+keySize],
+		})
+		offset = keyOffset + keySize
+	}
+	return entries, nil
+}
+
+// LoadHint 使用hint文件重建索引，不需要读取value
+func (w *WAL) LoadHint(hintPath string, memIndex index.Index) error {
+	buf, err := os.ReadFile(hintPath)
+	if err != nil {
+		return err
+	}
+	if w.aead != nil {
+		if len(buf) < envelopeHeaderLength {
+			return ErrHintCorrupted
+		}
+		if buf, err = w.open(buf[envelopeHeaderLength:], hintSealOffset); err != nil {
+			return ErrHintCorrupted
+		}
+	}
+	entries, err := parseHint(buf, w.GetOffset())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		pos := &record.Pos{
+			FileID: w.GetFileID(),
+			Offset: entry.Offset,
+			Size:   entry.Size,
+		}
+		if err := applyToIndex(memIndex, entry.Key, entry.RecordType, entry.ExpireAt, pos); err != nil {
+			return err
+		}
+		w.countTombstone(entry.RecordType)
+	}
+	return nil
+}
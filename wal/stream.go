@@ -0,0 +1,177 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xia-Sang/bitcask/record"
+)
+
+var ErrStreamUnsupported = errors.New("streaming is not supported for this record")
+
+// streamBufferSize 流式读写时每次读写的大小
+const streamBufferSize = 32 * 1024
+
+// CanStream 判断size大小的value能否流式写入，
+// 加密、需要压缩或旧格式的文件必须先将value完整读入内存
+func (w *WAL) CanStream(size int64) bool {
+	if w.aead != nil || w.Version() == record.FormatV0 {
+		return false
+	}
+	return w.options.Compressor == nil || size < w.options.CompressThreshold
+}
+
+// AppendStream 从r中读取size字节作为value写入一条记录，边写边计算crc，
+// 读取失败时截断已写入的部分
+func (w *WAL) AppendStream(header *record.Header, r io.Reader, size int64) (*record.Pos, error) {
+	if !w.CanStream(size) {
+		return nil, ErrStreamUnsupported
+	}
+	if err := checkRecordSize(int64(len(header.Key)), size); err != nil {
+		return nil, err
+	}
+	if header.Timestamp == 0 {
+		header.Timestamp = time.Now().UnixNano()
+	}
+
+	startOffset := w.fileIO.GetOffset()
+	n, err := w.writeStream(header, r, size)
+	if err != nil {
+		if terr := w.fileIO.Truncate(startOffset); terr != nil {
+			return nil, fmt.Errorf("%v, truncate error: %v", err, terr)
+		}
+		return nil, err
+	}
+	if err := w.maybeSync(n); err != nil {
+		return nil, err
+	}
+
+	pos := &record.Pos{
+		FileID: w.fileIO.GetFileID(),
+		Offset: startOffset,
+		Size:   n,
+	}
+	if header.Seq > w.maxSeq {
+		w.maxSeq = header.Seq
+	}
+	w.addHint(header.Key, header.RecordType, header.ExpireAt, pos)
+	return pos, nil
+}
+
+// writeStream 写入记录头、key、value和crc，返回写入的字节数
+func (w *WAL) writeStream(header *record.Header, r io.Reader, size int64) (int64, error) {
+	crc := crc32.NewIEEE()
+	prefix := header.EncodePrefix(size)
+	crc.Write(prefix)
+	if _, err := w.fileIO.Write(prefix); err != nil {
+		return 0, fmt.Errorf("write error: %v", err)
+	}
+
+	buf := make([]byte, min(size, streamBufferSize))
+	for remain := size; remain > 0; {
+		chunk := buf[:min(remain, int64(len(buf)))]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, fmt.Errorf("read value error: %v", err)
+		}
+		crc.Write(chunk)
+		if _, err := w.fileIO.Write(chunk); err != nil {
+			return 0, fmt.Errorf("write error: %v", err)
+		}
+		remain -= int64(len(chunk))
+	}
+
+	if _, err := w.fileIO.Write(crc.Sum(nil)); err != nil {
+		return 0, fmt.Errorf("write error: %v", err)
+	}
+	return int64(len(prefix)) + size + record.CrcLength, nil
+}
+
+// OpenValueReader 打开读取pos处记录value的流，返回不包含key和value的记录头。
+// 读取使用单独打开的文件，不受wal关闭的影响；读完value后校验crc，
+// 校验失败时Read返回ErrCrcMismatch。加密、压缩或指向blob的记录返回ErrStreamUnsupported
+func (w *WAL) OpenValueReader(pos *record.Pos) (*record.Header, io.ReadCloser, error) {
+	if w.aead != nil || w.Version() == record.FormatV0 {
+		return nil, nil, ErrStreamUnsupported
+	}
+	f, err := os.Open(w.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open wal file: %v", err)
+	}
+
+	fixed := make([]byte, record.HeaderLengthV1)
+	if _, err := f.ReadAt(fixed, pos.Offset); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("read at error: %v", err)
+	}
+	header := record.DecodePrefix(fixed)
+	if header.Flags.Has(record.FlagCompressed) || header.Flags.Has(record.FlagBlob) {
+		f.Close()
+		return nil, nil, ErrStreamUnsupported
+	}
+	keySize, valueSize, total := record.PeekSize(fixed, record.FormatV1)
+	if total != pos.Size {
+		f.Close()
+		return nil, nil, w.corrupted(pos.Offset, w.GetOffset(), ErrInvalidRecordSize)
+	}
+	key := make([]byte, keySize)
+	if _, err := f.ReadAt(key, pos.Offset+record.HeaderLengthV1); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("read at error: %v", err)
+	}
+	header.Key = key
+
+	crc := crc32.NewIEEE()
+	crc.Write(fixed)
+	crc.Write(key)
+	valueOffset := pos.Offset + record.HeaderLengthV1 + keySize
+	return header, &valueReader{
+		f:         f,
+		r:         io.NewSectionReader(f, valueOffset, valueSize),
+		crc:       crc,
+		crcOffset: valueOffset + valueSize,
+	}, nil
+}
+
+// valueReader 流式读取value，读到末尾时校验crc
+type valueReader struct {
+	f         *os.File
+	r         io.Reader
+	crc       hash.Hash32
+	crcOffset int64
+	err       error
+}
+
+func (v *valueReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	v.crc.Write(p[:n])
+	if err == io.EOF {
+		err = v.verify()
+	}
+	v.err = err
+	return n, err
+}
+
+// verify 校验crc，校验通过返回io.EOF
+func (v *valueReader) verify() error {
+	buf := make([]byte, record.CrcLength)
+	if _, err := v.f.ReadAt(buf, v.crcOffset); err != nil {
+		return fmt.Errorf("read at error: %v", err)
+	}
+	if binary.BigEndian.Uint32(buf) != v.crc.Sum32() {
+		return ErrCrcMismatch
+	}
+	return io.EOF
+}
+
+func (v *valueReader) Close() error {
+	return v.f.Close()
+}
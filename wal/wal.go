@@ -1,95 +1,420 @@
 package wal
 
 import (
-	"encoding/binary"
+	"bytes"
+	"crypto/cipher"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
+	"time"
 
+	"github.com/xia-Sang/bitcask/compress"
+	"github.com/xia-Sang/bitcask/encrypt"
 	"github.com/xia-Sang/bitcask/file_manage"
 	"github.com/xia-Sang/bitcask/index"
 	"github.com/xia-Sang/bitcask/record"
 )
 
+var (
+	ErrInvalidRecordSize = errors.New("invalid record size")
+	ErrCrcMismatch       = errors.New("crc check failed")
+	ErrIncompleteBatch   = errors.New("incomplete batch")
+)
+
+// CorruptedError 记录损坏错误，Offset之后的数据无法解析
+type CorruptedError struct {
+	FileID   int64 // 文件ID
+	Offset   int64 // 损坏记录的起始偏移量
+	FileSize int64 // 文件大小
+	Err      error // 损坏原因
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("wal file %d corrupted at offset %d: %v", e.FileID, e.Offset, e.Err)
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Options WAL写入选项
+type Options struct {
+	SyncWrite    bool   // 每次写入后都同步到磁盘
+	BytesPerSync int64  // 累计写入多少字节后同步，0表示不按字节数同步
+	BaseSeq      uint64 // 新建文件时写入文件头的序列号
+
+	Compressor        compress.Compressor // 写入时使用的压缩算法，nil表示不压缩
+	CompressThreshold int64               // value长度达到该值时才压缩
+	MaxValueLength    int64               // 解压后value的最大长度，0表示使用格式的上限
+
+	Keys encrypt.KeyProvider // 加密密钥，nil表示新文件不加密
+
+	DisableHint bool // 不在内存中记录hint，用于不需要hint文件的文件
+
+	OnSync func(d time.Duration, err error) // 每次同步文件后调用，用于统计同步次数和耗时
+}
+
 type WAL struct {
-	fileIO file_manage.FileManager
+	fileIO    file_manage.FileManager
+	path      string      // 文件路径
+	hints     []HintEntry // 尚未写入hint文件的记录位置
+	options   Options     // 写入选项
+	unsynced  int64       // 上次同步后写入的字节数
+	header    FileHeader  // 文件头
+	dataStart int64       // 第一条记录的偏移量，v0文件为0
+	maxSeq    uint64      // 文件中记录的最大序列号
+	deleted   int64       // 文件中生效的墓碑记录数
+	aead      cipher.AEAD // 加密器，文件未加密时为nil
 }
 
+// NewWAL 创建wal，每次写入后都会同步到磁盘
 func NewWAL(dirPath string, fileID int64) (*WAL, error) {
-	fileIO, err := file_manage.NewFileManager(dirPath, fileID)
+	return NewWALWithOptions(dirPath, fileID, Options{SyncWrite: true})
+}
+
+// NewWALWithOptions 使用指定的写入选项创建wal
+func NewWALWithOptions(dirPath string, fileID int64, options Options) (*WAL, error) {
+	fileIO, err := file_manage.NewFileManagerWithOptions(dirPath, fileID, file_manage.Options{OnSync: options.OnSync})
 	if err != nil {
 		return nil, err
 	}
-	return &WAL{
-		fileIO: fileIO,
-	}, nil
+	w := &WAL{
+		fileIO:  fileIO,
+		path:    dirPath,
+		options: options,
+	}
+	if err := w.initHeader(); err != nil {
+		fileIO.Close()
+		return nil, err
+	}
+	return w, nil
 }
 func (w *WAL) ReadAt(offset int64, length int64) ([]byte, error) {
 	return w.fileIO.ReadAt(offset, length)
 }
-func (w *WAL) LoadWal(memIndex index.Index) error {
-	// 读取WAL所有数据
-	offset := int64(0)
-	for {
-		var headerLength int64 = 1 + 4 + 4
-		headerBytes, err := w.ReadAt(offset, headerLength)
+
+// ReadRecord 按文件的格式版本读取并解析指定位置的记录
+func (w *WAL) ReadRecord(pos *record.Pos) (*record.Header, error) {
+	data, err := w.ReadAt(pos.Offset, pos.Size)
+	if err != nil {
+		return nil, err
+	}
+	if w.aead != nil {
+		if len(data) < envelopeHeaderLength {
+			return nil, w.corrupted(pos.Offset, w.GetOffset(), io.ErrUnexpectedEOF)
+		}
+		if data, err = w.open(data[envelopeHeaderLength:], pos.Offset); err != nil {
+			return nil, w.corrupted(pos.Offset, w.GetOffset(), err)
+		}
+	}
+	header := record.Decode(data, w.Version())
+	if header == nil {
+		return nil, w.corrupted(pos.Offset, w.GetOffset(), ErrCrcMismatch)
+	}
+	if err := w.decompress(header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// ReadRecordHeader 读取指定位置记录的记录头和key，不读取value，也不校验crc，
+// 校验在读取完整记录时进行。加密或旧格式的文件需要读取完整的记录，返回时丢弃value
+func (w *WAL) ReadRecordHeader(pos *record.Pos) (*record.Header, error) {
+	if w.aead != nil || w.Version() == record.FormatV0 {
+		header, err := w.ReadRecord(pos)
 		if err != nil {
-			if err == io.EOF {
-				break
+			return nil, err
+		}
+		header.Value = nil
+		return header, nil
+	}
+	fixed, err := w.ReadAt(pos.Offset, record.HeaderLengthV1)
+	if err != nil {
+		return nil, err
+	}
+	header := record.DecodePrefix(fixed)
+	keySize, _, total := record.PeekSize(fixed, record.FormatV1)
+	if header == nil || total != pos.Size {
+		return nil, w.corrupted(pos.Offset, w.GetOffset(), ErrInvalidRecordSize)
+	}
+	if header.Key, err = w.ReadAt(pos.Offset+record.HeaderLengthV1, keySize); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// MaxSeq 返回文件中已知的最大序列号，包括文件头中的序列号和遍历或写入过的记录
+func (w *WAL) MaxSeq() uint64 {
+	return max(w.maxSeq, w.header.BaseSeq)
+}
+
+// Tombstones 返回加载和写入的墓碑记录数，未提交事务中的墓碑不计入
+func (w *WAL) Tombstones() int64 {
+	return w.deleted
+}
+
+// DataStart 返回第一条记录的偏移量，之前为文件头
+func (w *WAL) DataStart() int64 {
+	return w.dataStart
+}
+
+// countTombstone 记录的类型为删除时增加墓碑计数
+func (w *WAL) countTombstone(typ record.RecordType) {
+	if typ == record.RecordTypeDeleted {
+		w.deleted++
+	}
+}
+
+// LoadWal 加载wal文件重建索引，事务中的记录只有在读到提交记录后才会生效，
+// 文件末尾未提交的事务视为损坏的记录
+func (w *WAL) LoadWal(memIndex index.Index) error {
+	fileSize, err := w.fileIO.Size()
+	if err != nil {
+		return fmt.Errorf("failed to get file size: %v", err)
+	}
+
+	var (
+		batchId    []byte
+		batchStart int64 = -1
+		pending    []*pendingRecord
+	)
+	err = w.Iterate(func(header *record.Header, pos *record.Pos) error {
+		switch header.RecordType {
+		case record.RecordTypeTransactionBegin:
+			if batchStart >= 0 {
+				return w.corrupted(batchStart, fileSize, ErrIncompleteBatch)
+			}
+			batchId = header.Key
+			batchStart = pos.Offset
+			pending = pending[:0]
+		case record.RecordTypeTransactionCommit:
+			if batchStart < 0 || !bytes.Equal(batchId, header.Key) {
+				return w.corrupted(pos.Offset, fileSize, ErrIncompleteBatch)
+			}
+			for _, p := range pending {
+				if err := w.loadRecord(memIndex, p.header, p.pos); err != nil {
+					return err
+				}
 			}
-			return fmt.Errorf("read at error: %v", err)
+			batchStart = -1
+			pending = pending[:0]
+		case record.RecordTypeTransactionRollback:
+			batchStart = -1
+			pending = pending[:0]
+		default:
+			if batchStart >= 0 {
+				pending = append(pending, &pendingRecord{header: header, pos: pos})
+				return nil
+			}
+			return w.loadRecord(memIndex, header, pos)
+		}
+		return nil
+	})
+
+	// 事务写到一半时从事务开始的位置截断
+	var corrupted *CorruptedError
+	if errors.As(err, &corrupted) {
+		if batchStart >= 0 && batchStart < corrupted.Offset {
+			corrupted.Offset = batchStart
+		}
+		w.SetOffset(corrupted.Offset)
+	}
+	if err != nil {
+		return err
+	}
+	if batchStart >= 0 {
+		w.SetOffset(batchStart)
+		return w.corrupted(batchStart, fileSize, ErrIncompleteBatch)
+	}
+	return nil
+}
+
+// pendingRecord 等待事务提交的记录
+type pendingRecord struct {
+	header *record.Header
+	pos    *record.Pos
+}
+
+// loadRecord 将一条记录应用到索引并记录hint
+func (w *WAL) loadRecord(memIndex index.Index, header *record.Header, pos *record.Pos) error {
+	if err := applyToIndex(memIndex, header.Key, header.RecordType, header.ExpireAt, pos); err != nil {
+		return err
+	}
+	w.countTombstone(header.RecordType)
+	w.addHint(header.Key, header.RecordType, header.ExpireAt, pos)
+	return nil
+}
+
+// applyToIndex 将一条记录应用到索引，已过期的记录视为删除
+func applyToIndex(memIndex index.Index, key []byte, typ record.RecordType, expireAt int64, pos *record.Pos) error {
+	if typ == record.RecordTypeNormal && record.IsExpired(expireAt, time.Now().UnixNano()) {
+		typ = record.RecordTypeDeleted
+	}
+	if typ == record.RecordTypeNormal {
+		if err := memIndex.Put(key, pos); err != nil {
+			return fmt.Errorf("put to memIndex error: %v", err)
+		}
+	} else if typ == record.RecordTypeDeleted {
+		// 合并后墓碑记录对应的key可能已不在索引中
+		if err := memIndex.Delete(key); err != nil && err != index.ErrKeyNotFound {
+			return fmt.Errorf("delete from memIndex error: %v", err)
+		}
+	}
+	return nil
+}
+
+// Iterate 按顺序遍历WAL中的所有记录，遍历结束后将偏移量设置到文件末尾。
+// 遇到损坏的记录时返回CorruptedError，偏移量停在最后一条有效记录之后
+func (w *WAL) Iterate(fn func(header *record.Header, pos *record.Pos) error) error {
+	offset, err := w.scan(func(header *record.Header, pos *record.Pos) error {
+		if header.Seq > w.maxSeq {
+			w.maxSeq = header.Seq
 		}
-		recordType := record.RecordType(headerBytes[0])
-		keyLength := binary.BigEndian.Uint32(headerBytes[1:5])
-		valueLength := binary.BigEndian.Uint32(headerBytes[5:9])
+		return fn(header, pos)
+	})
+	var corrupted *CorruptedError
+	if err == nil || errors.As(err, &corrupted) {
+		w.SetOffset(offset)
+	}
+	return err
+}
 
-		var reminderDataLength int64 = int64(keyLength) + int64(valueLength) + 4
-		offset += headerLength
-		reminderData, err := w.ReadAt(offset, reminderDataLength)
+// Each 按顺序只读遍历WAL中的所有记录，不修改偏移量等状态，
+// 可以在不持有锁的情况下遍历其他地方正在读取的已封存文件
+func (w *WAL) Each(fn func(header *record.Header, pos *record.Pos) error) error {
+	_, err := w.scan(fn)
+	return err
+}
+
+// scan 从第一条记录开始遍历，返回遍历停止的位置，遇到损坏的记录时停在该记录之前
+func (w *WAL) scan(fn func(header *record.Header, pos *record.Pos) error) (int64, error) {
+	fileSize, err := w.fileIO.Size()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file size: %v", err)
+	}
+
+	offset := w.dataStart
+	for offset < fileSize {
+		header, length, err := w.readNext(offset, fileSize)
 		if err != nil {
-			return fmt.Errorf("read at error: %v", err)
-		}
-		key := reminderData[:keyLength]
-		_ = reminderData[keyLength : keyLength+valueLength]
-		crc := binary.BigEndian.Uint32(reminderData[keyLength+valueLength : keyLength+valueLength+4])
-		data := append(headerBytes, reminderData...)
-		expectCrc := crc32.ChecksumIEEE(data[:headerLength+reminderDataLength-4])
-		if crc != expectCrc {
-			return fmt.Errorf("crc check failed")
-		}
-		offset += reminderDataLength
-		length := headerLength + reminderDataLength
+			return offset, err
+		}
+		if err := w.decompress(header); err != nil {
+			return offset, err
+		}
 		pos := &record.Pos{
 			FileID: w.GetFileID(),
-			Offset: offset - length,
+			Offset: offset,
 			Size:   length,
 		}
-		if recordType == record.RecordTypeNormal {
-			if err := memIndex.Put(key, pos); err != nil {
-				return fmt.Errorf("put to memIndex error: %v", err)
-			}
-		} else if recordType == record.RecordTypeDeleted {
-			if err := memIndex.Delete(key); err != nil {
-				return fmt.Errorf("delete from memIndex error: %v", err)
-			}
+		offset += length
+		if err := fn(header, pos); err != nil {
+			return offset, err
 		}
 	}
-	w.SetOffset(offset)
+	return offset, nil
+}
+
+// readNext 按文件的格式版本读取offset处的记录，返回记录和记录在文件中的长度
+func (w *WAL) readNext(offset int64, fileSize int64) (*record.Header, int64, error) {
+	version := w.Version()
+	if w.aead != nil {
+		data, length, err := w.readSealed(offset, fileSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		header := record.Decode(data, version)
+		if header == nil {
+			return nil, 0, w.corrupted(offset, fileSize, ErrCrcMismatch)
+		}
+		return header, length, nil
+	}
+
+	headerLength := record.FixedHeaderLength(version)
+	if offset+headerLength > fileSize {
+		return nil, 0, w.corrupted(offset, fileSize, io.ErrUnexpectedEOF)
+	}
+	headerBytes, err := w.ReadAt(offset, headerLength)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read at error: %v", err)
+	}
+	keyLength, valueLength, length := record.PeekSize(headerBytes, version)
+
+	// 长度字段损坏时直接报错，避免按错误的长度分配内存。
+	// 只检查格式本身的限制，配置的长度限制只用于写入，调小后已写入的记录仍然可以读取
+	if err := checkRecordSize(keyLength, valueLength); err != nil {
+		return nil, 0, w.corrupted(offset, fileSize, err)
+	}
+	if offset+length > fileSize {
+		return nil, 0, w.corrupted(offset, fileSize, io.ErrUnexpectedEOF)
+	}
+	data, err := w.ReadAt(offset, length)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read at error: %v", err)
+	}
+	header := record.Decode(data, version)
+	if header == nil {
+		return nil, 0, w.corrupted(offset, fileSize, ErrCrcMismatch)
+	}
+	return header, length, nil
+}
+
+// corrupted 构造损坏记录错误
+func (w *WAL) corrupted(offset int64, fileSize int64, err error) error {
+	return &CorruptedError{
+		FileID:   w.GetFileID(),
+		Offset:   offset,
+		FileSize: fileSize,
+		Err:      err,
+	}
+}
+
+// Truncate 将文件截断到指定大小，用于丢弃尾部损坏的记录
+func (w *WAL) Truncate(size int64) error {
+	return w.fileIO.Truncate(size)
+}
+
+// checkRecordSize 检查key和value长度是否超出格式允许的最大值
+func checkRecordSize(keySize, valueSize int64) error {
+	if keySize > record.MaxKeySize {
+		return fmt.Errorf("%w: key size %d exceeds limit", ErrInvalidRecordSize, keySize)
+	}
+	if valueSize > record.MaxValueSize {
+		return fmt.Errorf("%w: value size %d exceeds limit", ErrInvalidRecordSize, valueSize)
+	}
 	return nil
 }
+
 func (w *WAL) Append(key []byte, value []byte, typ record.RecordType) (*record.Pos, error) {
-	// 创建记录头
-	header := &record.Header{
+	return w.AppendRecord(&record.Header{
 		Key:        key,
 		Value:      value,
 		RecordType: typ,
+	})
+}
+
+// AppendRecord 写入一条记录，返回记录的位置信息
+func (w *WAL) AppendRecord(header *record.Header) (*record.Pos, error) {
+	if err := checkRecordSize(int64(len(header.Key)), int64(len(header.Value))); err != nil {
+		return nil, err
 	}
 
-	// 序列化记录
-	data := header.ToBytes()
+	// 按文件的格式版本序列化记录
+	if header.Timestamp == 0 {
+		header.Timestamp = time.Now().UnixNano()
+	}
+	data, err := w.encodeRecord(header, w.Version())
+	if err != nil {
+		return nil, err
+	}
 
 	// 获取写入前的偏移量
 	startOffset := w.fileIO.GetOffset()
+	if w.aead != nil {
+		if data, err = w.seal(data, startOffset); err != nil {
+			return nil, err
+		}
+	}
 
 	// 写入数据
 	n, err := w.fileIO.Write(data)
@@ -97,9 +422,9 @@ func (w *WAL) Append(key []byte, value []byte, typ record.RecordType) (*record.P
 		return nil, fmt.Errorf("write error: %v", err)
 	}
 
-	// 确保数据已写入磁盘
-	if err := w.fileIO.Sync(); err != nil {
-		return nil, fmt.Errorf("sync error: %v", err)
+	// 按写入选项同步到磁盘
+	if err := w.maybeSync(n); err != nil {
+		return nil, err
 	}
 
 	// 返回位置信息
@@ -108,16 +433,36 @@ func (w *WAL) Append(key []byte, value []byte, typ record.RecordType) (*record.P
 		Offset: startOffset,
 		Size:   n,
 	}
+	if header.Seq > w.maxSeq {
+		w.maxSeq = header.Seq
+	}
+	w.countTombstone(header.RecordType)
+	w.addHint(header.Key, header.RecordType, header.ExpireAt, pos)
 
 	return pos, nil
 }
 
+// maybeSync 记录写入的字节数，并按写入选项同步到磁盘
+func (w *WAL) maybeSync(n int64) error {
+	w.unsynced += n
+	if w.options.SyncWrite || (w.options.BytesPerSync > 0 && w.unsynced >= w.options.BytesPerSync) {
+		if err := w.Sync(); err != nil {
+			return fmt.Errorf("sync error: %v", err)
+		}
+	}
+	return nil
+}
+
 func (w *WAL) Write(data []byte) (int64, error) {
 	return w.fileIO.Write(data)
 }
 
 func (w *WAL) Sync() error {
-	return w.fileIO.Sync()
+	if err := w.fileIO.Sync(); err != nil {
+		return err
+	}
+	w.unsynced = 0
+	return nil
 }
 
 func (w *WAL) Close() error {
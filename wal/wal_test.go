@@ -2,10 +2,16 @@ package wal
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/iotest"
 
+	"github.com/xia-Sang/bitcask/encrypt"
+	"github.com/xia-Sang/bitcask/index"
 	"github.com/xia-Sang/bitcask/record"
 )
 
@@ -40,8 +46,9 @@ func TestWAL(t *testing.T) {
 		if pos.Size <= 0 {
 			t.Errorf("Invalid Size: %d", pos.Size)
 		}
-		if pos.Offset != 0 {
-			t.Errorf("Wrong initial offset, got %d, want 0", pos.Offset)
+		// 第一条记录位于文件头之后
+		if pos.Offset != FileHeaderLength {
+			t.Errorf("Wrong initial offset, got %d, want %d", pos.Offset, FileHeaderLength)
 		}
 	})
 
@@ -64,7 +71,7 @@ func TestWAL(t *testing.T) {
 			{[]byte("key3"), []byte("value3"), record.RecordTypeCheckpoint},
 		}
 
-		var lastOffset int64 = 0
+		var lastOffset int64 = FileHeaderLength
 		for i, r := range records {
 			pos, err := wal.Append(r.key, r.value, r.typ)
 			if err != nil {
@@ -120,8 +127,8 @@ func TestWAL(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to stat file: %v", err)
 		}
-		if info.Size() != pos.Size {
-			t.Errorf("File size mismatch: got %d, want %d", info.Size(), pos.Size)
+		if info.Size() != FileHeaderLength+pos.Size {
+			t.Errorf("File size mismatch: got %d, want %d", info.Size(), FileHeaderLength+pos.Size)
 		}
 
 		// 重新打开文件验证内容持久化
@@ -132,8 +139,8 @@ func TestWAL(t *testing.T) {
 		defer wal2.Close()
 
 		// 验证偏移量是否正确恢复
-		if offset := wal2.GetOffset(); offset != pos.Size {
-			t.Errorf("Offset not restored correctly: got %d, want %d", offset, pos.Size)
+		if offset := wal2.GetOffset(); offset != FileHeaderLength+pos.Size {
+			t.Errorf("Offset not restored correctly: got %d, want %d", offset, FileHeaderLength+pos.Size)
 		}
 	})
 
@@ -168,6 +175,157 @@ func TestWAL(t *testing.T) {
 		}
 	})
 
+	t.Run("Corrupted Length", func(t *testing.T) {
+		walFile := filepath.Join(dir, "5.wal")
+		wal, err := NewWALWithOptions(walFile, 5, Options{})
+		if err != nil {
+			t.Fatalf("NewWAL failed: %v", err)
+		}
+		defer wal.Close()
+
+		if _, err := wal.Append([]byte("key"), []byte("value"), record.RecordTypeNormal); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+
+		// 破坏value长度字段，超出文件末尾的长度视为损坏
+		data, err := os.ReadFile(walFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.BigEndian.PutUint32(data[FileHeaderLength+6:FileHeaderLength+10], 0xffffffff)
+		if err := os.WriteFile(walFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		memIndex, _ := index.NewIndex("btree")
+		err = wal.LoadWal(memIndex)
+		var corrupted *CorruptedError
+		if !errors.As(err, &corrupted) || !errors.Is(err, io.ErrUnexpectedEOF) || corrupted.Offset != FileHeaderLength {
+			t.Errorf("Expected CorruptedError at %d, got %v", FileHeaderLength, err)
+		}
+	})
+
+	t.Run("File Header", func(t *testing.T) {
+		walFile := filepath.Join(dir, "6.wal")
+		wal, err := NewWALWithOptions(walFile, 6, Options{BaseSeq: 10})
+		if err != nil {
+			t.Fatalf("NewWAL failed: %v", err)
+		}
+		if wal.Version() != record.FormatCurrent {
+			t.Errorf("Version mismatch: got %d, want %d", wal.Version(), record.FormatCurrent)
+		}
+		if _, err := wal.AppendRecord(&record.Header{Key: []byte("key"), Value: []byte("value"), Seq: 11}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		createdAt := wal.Header().CreatedAt
+		wal.Close()
+
+		// 重新打开后文件头和记录中的序列号不变
+		wal, err = NewWAL(walFile, 6)
+		if err != nil {
+			t.Fatalf("Reopen WAL failed: %v", err)
+		}
+		if header := wal.Header(); header.CreatedAt != createdAt || header.BaseSeq != 10 {
+			t.Errorf("File header mismatch: got %+v", header)
+		}
+		var seqs []uint64
+		err = wal.Iterate(func(header *record.Header, pos *record.Pos) error {
+			seqs = append(seqs, header.Seq)
+			if header.Timestamp == 0 {
+				t.Error("Timestamp should be set")
+			}
+			return nil
+		})
+		if err != nil || len(seqs) != 1 || seqs[0] != 11 || wal.MaxSeq() != 11 {
+			t.Errorf("Iterate mismatch: seqs=%v maxSeq=%d err=%v", seqs, wal.MaxSeq(), err)
+		}
+		wal.Close()
+
+		// 破坏文件头
+		data, err := os.ReadFile(walFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[4] ^= 0xff
+		if err := os.WriteFile(walFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewWAL(walFile, 6); !errors.Is(err, ErrInvalidFileHeader) {
+			t.Errorf("Expected ErrInvalidFileHeader, got %v", err)
+		}
+
+		// 写了一半的文件头重新写入
+		if err := os.WriteFile(walFile, fileMagic[:2], 0644); err != nil {
+			t.Fatal(err)
+		}
+		wal, err = NewWAL(walFile, 6)
+		if err != nil {
+			t.Fatalf("Reopen WAL failed: %v", err)
+		}
+		if wal.GetOffset() != FileHeaderLength {
+			t.Errorf("Offset mismatch: got %d, want %d", wal.GetOffset(), FileHeaderLength)
+		}
+		wal.Close()
+	})
+
+	t.Run("Legacy Format", func(t *testing.T) {
+		walFile := filepath.Join(dir, "7.wal")
+		var data []byte
+		data = append(data, (&record.Header{Key: []byte("a"), Value: []byte("1")}).ToBytes()...)
+		data = append(data, (&record.Header{Key: []byte("b"), Value: []byte("2")}).ToBytes()...)
+		if err := os.WriteFile(walFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// 没有文件头的文件按v0格式读取
+		wal, err := NewWAL(walFile, 7)
+		if err != nil {
+			t.Fatalf("NewWAL failed: %v", err)
+		}
+		defer wal.Close()
+		if wal.Version() != record.FormatV0 {
+			t.Errorf("Version mismatch: got %d, want %d", wal.Version(), record.FormatV0)
+		}
+		memIndex, _ := index.NewIndex("btree")
+		if err := wal.LoadWal(memIndex); err != nil {
+			t.Fatalf("LoadWal failed: %v", err)
+		}
+		pos, err := memIndex.Get([]byte("b"))
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		header, err := wal.ReadRecord(pos)
+		if err != nil || !bytes.Equal(header.Value, []byte("2")) {
+			t.Errorf("ReadRecord mismatch: header=%v err=%v", header, err)
+		}
+	})
+
+	t.Run("Nonce Failure", func(t *testing.T) {
+		ring := encrypt.NewKeyRing()
+		if err := ring.Rotate(1, bytes.Repeat([]byte("k"), 32)); err != nil {
+			t.Fatal(err)
+		}
+		walFile := filepath.Join(dir, "8.wal")
+		wal, err := NewWALWithOptions(walFile, 8, Options{Keys: ring})
+		if err != nil {
+			t.Fatalf("NewWAL failed: %v", err)
+		}
+		defer wal.Close()
+
+		// 随机数来源失败时返回错误，不写入任何数据
+		defer func(r io.Reader) { nonceReader = r }(nonceReader)
+		nonceReader = iotest.ErrReader(errors.New("entropy exhausted"))
+		offset := wal.GetOffset()
+		if _, err := wal.Append([]byte("key"), []byte("value"), record.RecordTypeNormal); err == nil {
+			t.Error("Expected error when nonce generation fails")
+		}
+		if _, err := wal.AppendBatch([]byte("batch"), []*record.Header{{Key: []byte("key"), Value: []byte("value")}}); err == nil {
+			t.Error("Expected error when nonce generation fails")
+		}
+		if wal.GetOffset() != offset {
+			t.Errorf("nothing should be written, offset %d want %d", wal.GetOffset(), offset)
+		}
+	})
+
 	t.Run("Invalid File Path", func(t *testing.T) {
 		// 使用无效的文件路径
 		invalidPath := filepath.Join("nonexistent", "invalid.wal")